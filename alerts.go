@@ -2,18 +2,57 @@ package alerts
 
 import (
 	"log"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/godbus/dbus"
 	"github.com/james-lawrence/systemd-alert/systemd"
 )
 
+// severities of alerts.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
 // Notifier interface for sending alerts.
 type Notifier interface {
 	Alert(units ...*systemd.UnitStatus)
 }
 
+// Resolver is implemented by notifiers that want to be told when a unit
+// they were alerted about has recovered.
+type Resolver interface {
+	Resolve(units ...*systemd.UnitStatus)
+}
+
+// Deliverer is implemented by notifiers that can report whether a batch was
+// delivered, Alert logs the same error instead of returning it.
+type Deliverer interface {
+	Deliver(units ...*systemd.UnitStatus) error
+}
+
+// ResolveDeliverer is implemented by resolvers that can report whether the
+// recovery of a batch was delivered, Resolve logs the same error instead of
+// returning it.
+type ResolveDeliverer interface {
+	DeliverResolve(units ...*systemd.UnitStatus) error
+}
+
+// Starter is implemented by notifiers that need to do work before the
+// first batch is delivered. Start may be called once per run loop.
+type Starter interface {
+	Start()
+}
+
+// Stopper is implemented by notifiers with background work that must end
+// when they are replaced by a configuration reload.
+type Stopper interface {
+	Stop()
+}
+
 func isChanged(match filter) func(*systemd.UnitStatus, *systemd.UnitStatus) bool {
 	return func(oldu, newu *systemd.UnitStatus) bool {
 		// if new state matches then use new unit status.
@@ -21,13 +60,35 @@ func isChanged(match filter) func(*systemd.UnitStatus, *systemd.UnitStatus) bool
 	}
 }
 
-type runOption func(*RunConfig)
+// Observer receives progress reports from the event loop.
+type Observer interface {
+	// Ready is called once the loop has subscribed to systemd.
+	Ready()
+	// Progress is called periodically while the loop is processing events.
+	Progress(watched, active int)
+}
+
+// Heartbeater is implemented by observers that need progress reports more
+// often than once a second, e.g. to keep a short watchdog fed.
+type Heartbeater interface {
+	// Heartbeat is the interval between progress reports.
+	Heartbeat() time.Duration
+}
+
+type noopObserver struct{}
+
+func (noopObserver) Ready()            {}
+func (noopObserver) Progress(int, int) {}
+
+type runOption = func(*RunConfig)
 
 // RunConfig run configuration options
 type RunConfig struct {
 	Frequency       time.Duration
 	IgnoredServices []string
 	Notifiers       []Notifier
+	Settings        *Settings
+	Observer        Observer
 }
 
 // AlertFrequency how often to dump the alerts.
@@ -51,6 +112,21 @@ func AlertNotifiers(notifiers ...Notifier) func(*RunConfig) {
 	}
 }
 
+// AlertSettings share reloadable settings between loops, takes precedence over
+// AlertIgnoreServices and AlertNotifiers.
+func AlertSettings(s *Settings) func(*RunConfig) {
+	return func(c *RunConfig) {
+		c.Settings = s
+	}
+}
+
+// AlertObserver set the observer notified of the loop's progress.
+func AlertObserver(o Observer) func(*RunConfig) {
+	return func(c *RunConfig) {
+		c.Observer = o
+	}
+}
+
 // SafeRun - ensures there is a connection before attempting to
 // run.
 func SafeRun(conn *systemd.Conn, options ...runOption) {
@@ -58,125 +134,178 @@ func SafeRun(conn *systemd.Conn, options ...runOption) {
 		return
 	}
 
-	Run(conn, options...)
+	Run(NewDBusSource(conn), options...)
 }
 
-// Run - runs alerts
-func Run(conn *systemd.Conn, options ...runOption) {
+// Run - runs alerts for the events produced by the source.
+func Run(src EventSource, options ...runOption) {
 	config := RunConfig{
 		Frequency: 1 * time.Second,
+		Observer:  noopObserver{},
 	}
 
 	for _, opt := range options {
 		opt(&config)
 	}
 
-	events, err := receiveEvents(conn)
+	events, err := src.Events()
 	if err != nil {
-		conn.Close()
 		log.Println(err)
 		return
 	}
 
-	matcher := and(
-		IgnoreServices(config.IgnoredServices...),
-		or(FilterAutorestart, FilterFailed),
-	)
+	config.Observer.Ready()
+
+	if config.Settings == nil {
+		config.Settings = NewSettings(config.IgnoredServices, config.Notifiers...)
+		defer config.Settings.close()
+	}
+
+	// pending tracks the batches handed to the notifiers, the loop waits for
+	// them before returning.
+	pending := &sync.WaitGroup{}
+	defer pending.Wait()
 
-	for _, a := range config.Notifiers {
+	_, notifiers := config.Settings.current()
+	for _, a := range notifiers {
 		log.Printf("running %T\n", a)
+		if s, ok := a.(Starter); ok {
+			s.Start()
+		}
 	}
 
+	// units are keyed by their label so units with the same name from
+	// different sources do not collide.
+	// watched tracks every unit loaded by the sources.
+	watched := make(map[string]bool)
+	// active tracks units that have been alerted on and not yet recovered.
+	active := make(map[string]*systemd.UnitStatus)
+	resolved := make(map[string]*systemd.UnitStatus)
 	batch := make(map[string]*systemd.UnitStatus)
+	// alerted tracks when each unit was last alerted on for its cooldown.
+	alerted := make(map[string]time.Time)
+	// window is when the pending batch started by the clock of replayed
+	// events. their cooldowns and batches follow the time they were recorded
+	// so a replay alerts as the recording did regardless of its speed.
+	var window time.Time
+
+	flush := func() {
+		if len(batch) > 0 {
+			for _, units := range bySource(batch) {
+				config.Settings.deliver(false, units, pending)
+			}
+			batch = make(map[string]*systemd.UnitStatus)
+		}
+
+		if len(resolved) > 0 {
+			for _, units := range bySource(resolved) {
+				config.Settings.deliver(true, units, pending)
+			}
+			resolved = make(map[string]*systemd.UnitStatus)
+		}
+	}
+
 	ticker := time.NewTicker(config.Frequency)
 	defer ticker.Stop()
+	beat := time.Second
+	if h, ok := config.Observer.(Heartbeater); ok && h.Heartbeat() > 0 {
+		beat = h.Heartbeat()
+	}
+	heartbeat := time.NewTicker(beat)
+	defer heartbeat.Stop()
 	for {
 		select {
+		case _ = <-heartbeat.C:
+			config.Observer.Progress(len(watched), len(active))
 		case event, ok := <-events:
 			if !ok {
+				// deliver whatever is pending before the source went away.
+				flush()
 				return
 			}
 
-			original := batch[event.Name]
-			if original == nil {
-				original = &systemd.UnitStatus{}
-			}
-
-			if isChanged(matcher)(original, event) {
-				batch[event.Name] = event
-			}
-		case _ = <-ticker.C:
-			if len(batch) == 0 {
+			if event.Err != nil {
+				log.Println(event.Err)
 				continue
 			}
 
-			events := make([]*systemd.UnitStatus, 0, len(batch))
-			for _, unit := range batch {
-				events = append(events, unit)
-			}
-
-			for _, a := range config.Notifiers {
-				a.Alert(events...)
+			now := time.Now()
+			if !event.Time.IsZero() {
+				now = event.Time
+				if window.IsZero() {
+					window = now
+				}
+
+				if now.Sub(window) >= config.Frequency {
+					flush()
+					window = now
+				}
 			}
 
-			batch = make(map[string]*systemd.UnitStatus)
-		}
-	}
-}
-
-func receiveEvents(conn *systemd.Conn) (<-chan *systemd.UnitStatus, error) {
-	var (
-		err error
-	)
-	src := make(chan *dbus.Signal)
-	dst := make(chan *systemd.UnitStatus)
-	if err = conn.Subscribe(src); err != nil {
-		return nil, err
-	}
-
-	if err = conn.Signals(systemd.UnitPropertiesChangedSignal); err != nil {
-		return nil, err
-	}
-
-	go func() {
-		for s := range src {
-			var (
-				err           error
-				status        systemd.UnitEvent
-				unitName      dbus.Variant
-				unitLoadState dbus.Variant
-			)
+			label := event.Unit.Label()
 
-			if s.Body[0] != "org.freedesktop.systemd1.Unit" {
+			switch event.Type {
+			case EventLoaded:
+				watched[label] = true
 				continue
-			}
-
-			if status, err = systemd.DecodeUnitEvent(s); err != nil {
-				log.Println(err)
+			case EventRemoved:
+				delete(watched, label)
+				continue
+			case EventJobRemoved:
 				continue
 			}
 
-			if unitName, err = conn.GetUnitProperty(status.Path, "Id"); err != nil {
-				log.Println("failed to get unit property: Id", err)
-				continue
+			watched[label] = true
+
+			original := batch[label]
+			if original == nil {
+				original = &systemd.UnitStatus{}
 			}
 
-			if unitLoadState, err = conn.GetUnitProperty(status.Path, "LoadState"); err != nil {
-				log.Println("failed to get unit property: LoadState", err)
+			matcher, _ := config.Settings.current()
+			if isChanged(matcher)(original, event.Unit) {
+				if cooling(event.Unit, alerted[label], now) {
+					continue
+				}
+
+				alerted[label] = now
+				batch[label] = event.Unit
+				active[label] = event.Unit
+				delete(resolved, label)
 				continue
 			}
 
-			dst <- &systemd.UnitStatus{
-				Name:        unitName.Value().(string),
-				LoadState:   unitLoadState.Value().(string),
-				ActiveState: status.ActiveState,
-				SubState:    status.SubState,
-				Path:        status.Path,
+			if active[label] != nil && FilterRecovered(event.Unit) {
+				delete(active, label)
+				resolved[label] = event.Unit
+			}
+		case _ = <-ticker.C:
+			// replayed events are flushed by their own clock.
+			if window.IsZero() {
+				flush()
 			}
 		}
-	}()
+	}
+}
 
-	return dst, nil
+// cooling reports if the unit was alerted on within the cooldown declared in
+// its unit files.
+func cooling(unit *systemd.UnitStatus, last, now time.Time) bool {
+	if unit.Settings == nil || unit.Settings.Cooldown <= 0 {
+		return false
+	}
+
+	return now.Sub(last) < unit.Settings.Cooldown
+}
+
+// bySource splits the batch so every delivered batch describes a single
+// source, and therefore a single host.
+func bySource(batch map[string]*systemd.UnitStatus) map[string][]*systemd.UnitStatus {
+	sources := make(map[string][]*systemd.UnitStatus)
+	for _, unit := range batch {
+		sources[unit.Source] = append(sources[unit.Source], unit)
+	}
+	return sources
 }
 
 type filter func(*systemd.UnitStatus) bool
@@ -209,15 +338,58 @@ func filterByName(name string) filter {
 	}
 }
 
-// IgnoreServices ignore the provided services.
+// IgnoreServices ignore the provided services, names may be glob patterns
+// e.g. user@*.service.
 func IgnoreServices(names ...string) func(*systemd.UnitStatus) bool {
 	ignore := make(map[string]bool, len(names))
+	patterns := make([]string, 0, len(names))
 	for _, name := range names {
 		ignore[name] = true
+		if strings.ContainsAny(name, "*?[") {
+			patterns = append(patterns, name)
+		}
 	}
 
 	return func(status *systemd.UnitStatus) bool {
-		return !(ignore[status.Name])
+		if ignore[status.Name] {
+			return false
+		}
+
+		for _, p := range patterns {
+			if matched, _ := path.Match(p, status.Name); matched {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// ValidPattern checks the ignore pattern is well formed.
+func ValidPattern(pattern string) error {
+	_, err := path.Match(pattern, "")
+	return err
+}
+
+// IgnoreUnitSettings ignore units that opted out of alerting with Ignore= in
+// the [X-SystemdAlert] section of their unit files.
+func IgnoreUnitSettings(status *systemd.UnitStatus) bool {
+	return status.Settings == nil || !status.Settings.Ignore
+}
+
+// Severity of an alert about the unit. the severity declared in the unit
+// files takes precedence, otherwise failures are critical and restarts are
+// warnings.
+func Severity(status *systemd.UnitStatus) string {
+	switch {
+	case status.Settings != nil && status.Settings.Severity != "":
+		return status.Settings.Severity
+	case FilterFailed(status):
+		return SeverityCritical
+	case FilterAutorestart(status):
+		return SeverityWarning
+	default:
+		return SeverityInfo
 	}
 }
 
@@ -238,3 +410,15 @@ func FilterAutorestart(status *systemd.UnitStatus) bool {
 
 	return status.SubState == autorestart
 }
+
+// FilterRecovered matches units that have returned to a healthy state,
+// either running again or cleanly stopped.
+func FilterRecovered(status *systemd.UnitStatus) bool {
+	const (
+		active   = "active"
+		inactive = "inactive"
+		dead     = "dead"
+	)
+
+	return status.ActiveState == active || (status.ActiveState == inactive && status.SubState == dead)
+}
@@ -0,0 +1,469 @@
+package alerts_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/systemdtest"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+const timeout = 2 * time.Second
+
+type readiness chan struct{}
+
+func (t readiness) Ready()            { close(t) }
+func (t readiness) Progress(int, int) {}
+
+// start runs the alert loop against the fake manager, returning once it has
+// subscribed.
+func start(t *testing.T, srv *systemdtest.Server, options ...func(*alerts.RunConfig)) (*systemd.Conn, <-chan struct{}) {
+	return startSource(t, srv, nil, options...)
+}
+
+// startSource runs the alert loop against the fake manager using a source
+// configured with the given options.
+func startSource(t *testing.T, srv *systemdtest.Server, soptions []func(*alerts.DBusSource), options ...func(*alerts.RunConfig)) (*systemd.Conn, <-chan struct{}) {
+	conn, err := srv.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ready := make(readiness)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		alerts.Run(alerts.NewDBusSource(conn, soptions...), append(options, alerts.AlertFrequency(10*time.Millisecond), alerts.AlertObserver(ready))...)
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(timeout):
+		t.Fatal("run loop never became ready")
+	}
+
+	return conn, done
+}
+
+func TestRunAlertsOnFailure(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "active", "running")
+
+	rec := systemdtest.NewRecorder()
+	start(t, srv, alerts.AlertNotifiers(rec))
+
+	srv.SetResult("nginx.service", "core-dump", 3)
+	srv.SetState("nginx.service", "failed", "failed")
+
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 {
+		t.Fatalf("expected a single unit to be alerted, got %v", units)
+	}
+
+	if units[0].Name != "nginx.service" || units[0].SubState != "failed" || units[0].LoadState != "loaded" {
+		t.Errorf("unexpected unit status %+v", units[0])
+	}
+
+	if units[0].Result != "core-dump" || units[0].NRestarts != 3 {
+		t.Errorf("expected the service result and restarts, got %+v", units[0])
+	}
+
+	if units[0].Host.Hostname != systemdtest.Hostname || units[0].Host.MachineID != systemdtest.MachineID {
+		t.Errorf("unexpected host identity %+v", units[0].Host)
+	}
+
+	if srv.Subscribers() == 0 {
+		t.Error("expected the loop to subscribe to the manager")
+	}
+}
+
+func TestRunResolvesRecoveredUnits(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "active", "running")
+
+	rec := systemdtest.NewRecorder()
+	start(t, srv, alerts.AlertNotifiers(rec))
+
+	srv.SetState("nginx.service", "activating", "auto-restart")
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].SubState != "auto-restart" {
+		t.Fatalf("expected the restart to be alerted, got %v", units)
+	}
+
+	srv.SetState("nginx.service", "active", "running")
+	if units := systemdtest.Next(rec.Resolved, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the unit to be resolved, got %v", units)
+	}
+}
+
+func TestRunIgnoresServices(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("ignored.service", "active", "running")
+	srv.AddUnit("nginx.service", "active", "running")
+
+	rec := systemdtest.NewRecorder()
+	start(t, srv, alerts.AlertNotifiers(rec), alerts.AlertIgnoreServices("ignored.service"))
+
+	srv.SetState("ignored.service", "failed", "failed")
+	srv.SetState("nginx.service", "failed", "failed")
+
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected only nginx.service to be alerted, got %v", units)
+	}
+
+	if units := systemdtest.Next(rec.Alerts, 50*time.Millisecond); units != nil {
+		t.Fatalf("unexpected alert %v", units)
+	}
+}
+
+// stalled blocks every delivery until it is released.
+type stalled chan struct{}
+
+func (t stalled) Alert(...*systemd.UnitStatus) { <-t }
+
+// heartbeats reports the progress of the loop at the given interval.
+type heartbeats struct {
+	readiness
+	interval time.Duration
+	progress chan struct{}
+}
+
+func (t heartbeats) Heartbeat() time.Duration { return t.interval }
+func (t heartbeats) Progress(int, int) {
+	select {
+	case t.progress <- struct{}{}:
+	default:
+	}
+}
+
+func TestRunStalledNotifier(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "active", "running")
+
+	conn, err := srv.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stall := make(stalled)
+	defer close(stall)
+
+	rec := systemdtest.NewRecorder()
+	observer := heartbeats{readiness: make(readiness), interval: 10 * time.Millisecond, progress: make(chan struct{}, 1)}
+	go alerts.Run(alerts.NewDBusSource(conn), alerts.AlertFrequency(10*time.Millisecond), alerts.AlertNotifiers(stall, rec), alerts.AlertObserver(observer))
+
+	select {
+	case <-observer.readiness:
+	case <-time.After(timeout):
+		t.Fatal("run loop never became ready")
+	}
+
+	srv.SetState("nginx.service", "failed", "failed")
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the stalled notifier not to hold up the others, got %v", units)
+	}
+
+	// the progress buffered before the notifier stalled is discarded.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-observer.progress:
+		case <-time.After(timeout):
+			t.Fatal("expected the loop to keep reporting progress while a notifier is stalled")
+		}
+	}
+}
+
+func TestRunReloadsSettings(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "active", "running")
+	srv.AddUnit("worker.service", "active", "running")
+
+	previous := systemdtest.NewRecorder()
+	settings := alerts.NewSettings([]string{"worker.service"}, previous)
+	start(t, srv, alerts.AlertSettings(settings))
+
+	srv.SetState("nginx.service", "failed", "failed")
+	if units := systemdtest.Next(previous.Alerts, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected nginx.service to be alerted, got %v", units)
+	}
+
+	rec := systemdtest.NewRecorder()
+	settings.Reload(nil, rec)
+
+	srv.SetState("worker.service", "failed", "failed")
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].Name != "worker.service" {
+		t.Fatalf("expected worker.service to be alerted after the reload, got %v", units)
+	}
+
+	// the unit alerted before the reload is still resolved.
+	srv.SetState("nginx.service", "active", "running")
+	if units := systemdtest.Next(rec.Resolved, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected nginx.service to be resolved, got %v", units)
+	}
+
+	if units := systemdtest.Next(previous.Alerts, 50*time.Millisecond); units != nil {
+		t.Fatalf("unexpected alert delivered to the replaced notifier %v", units)
+	}
+}
+
+// stoppable records when it is stopped.
+type stoppable struct {
+	*systemdtest.Recorder
+	stopped chan struct{}
+}
+
+func (t stoppable) Stop() { close(t.stopped) }
+
+// startable counts how often it is started.
+type startable struct {
+	*systemdtest.Recorder
+	started *int32
+}
+
+func (t startable) Start() { atomic.AddInt32(t.started, 1) }
+
+func TestReloadStartsNewNotifiers(t *testing.T) {
+	kept := startable{Recorder: systemdtest.NewRecorder(), started: new(int32)}
+	added := startable{Recorder: systemdtest.NewRecorder(), started: new(int32)}
+
+	settings := alerts.NewSettings(nil)
+	settings.Reload(nil, kept)
+	settings.Reload(nil, kept, added)
+
+	if n := atomic.LoadInt32(kept.started); n != 1 {
+		t.Errorf("expected the retained notifier to be started once, got %d", n)
+	}
+
+	if n := atomic.LoadInt32(added.started); n != 1 {
+		t.Errorf("expected the added notifier to be started once, got %d", n)
+	}
+}
+
+func TestReloadStopsRemovedNotifiers(t *testing.T) {
+	kept := stoppable{Recorder: systemdtest.NewRecorder(), stopped: make(chan struct{})}
+	removed := stoppable{Recorder: systemdtest.NewRecorder(), stopped: make(chan struct{})}
+
+	settings := alerts.NewSettings(nil, kept, removed)
+	settings.Reload(nil, kept)
+
+	select {
+	case <-removed.stopped:
+	case <-time.After(timeout):
+		t.Fatal("expected the removed notifier to be stopped")
+	}
+
+	select {
+	case <-kept.stopped:
+		t.Fatal("expected the retained notifier to keep running")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRunUnitSettings(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("nginx.service", "[X-SystemdAlert]\nSeverity=warning\nOwner=platform\n")
+	write("batch.service", "[X-SystemdAlert]\nIgnore=yes\n")
+
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "active", "running")
+	srv.AddUnit("batch.service", "active", "running")
+	srv.SetUnitFiles("nginx.service", "/nginx.service")
+	srv.SetUnitFiles("batch.service", "/batch.service")
+
+	rec := systemdtest.NewRecorder()
+	startSource(t, srv, []func(*alerts.DBusSource){alerts.SourceUnitFiles(root)}, alerts.AlertNotifiers(rec))
+
+	srv.SetState("batch.service", "failed", "failed")
+	srv.SetState("nginx.service", "failed", "failed")
+
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected only nginx.service to be alerted, got %v", units)
+	}
+
+	if severity := alerts.Severity(units[0]); severity != "warning" || units[0].Settings.Owner != "platform" {
+		t.Fatalf("expected the unit file settings, got %s %+v", severity, units[0].Settings)
+	}
+
+	// settings are reread once the manager reports the unit files changed.
+	write("nginx.service", "[X-SystemdAlert]\nSeverity=critical\n")
+	srv.UnitFilesChanged()
+	srv.SetState("nginx.service", "active", "running")
+	srv.SetState("nginx.service", "failed", "failed")
+
+	if units = systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || alerts.Severity(units[0]) != "critical" {
+		t.Fatalf("expected the updated unit file settings, got %v", units)
+	}
+}
+
+func TestIgnoreServicesPatterns(t *testing.T) {
+	keep := alerts.IgnoreServices("ignored.service", "user@*.service")
+
+	for name, expected := range map[string]bool{
+		"ignored.service":     false,
+		"user@1000.service":   false,
+		"nginx.service":       true,
+		"user-1000.slice":     true,
+		"ignored.service.bak": true,
+	} {
+		if actual := keep(&systemd.UnitStatus{Name: name}); actual != expected {
+			t.Errorf("%s: expected %t, got %t", name, expected, actual)
+		}
+	}
+
+	if err := alerts.ValidPattern("bad[.service"); err == nil {
+		t.Error("expected a malformed pattern to be rejected")
+	}
+}
+
+func TestRunLabelsSource(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "active", "running")
+
+	rec := systemdtest.NewRecorder()
+	soptions := []func(*alerts.DBusSource){
+		alerts.SourceName("web1"),
+		alerts.SourceLabels(map[string]string{"team": "platform"}),
+	}
+	startSource(t, srv, soptions, alerts.AlertNotifiers(rec))
+
+	srv.SetState("nginx.service", "failed", "failed")
+
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 {
+		t.Fatalf("expected a single unit to be alerted, got %v", units)
+	}
+
+	if units[0].Label() != "web1/nginx.service" {
+		t.Errorf("unexpected label %s", units[0].Label())
+	}
+
+	if units[0].Host.Labels["team"] != "platform" {
+		t.Errorf("unexpected host labels %v", units[0].Host.Labels)
+	}
+}
+
+func TestRunStopsWhenConnectionCloses(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+
+	conn, done := start(t, srv)
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("run loop did not stop after the connection closed")
+	}
+}
+
+// closable is a source that records when it is closed.
+type closable struct {
+	events chan alerts.Event
+	closed chan struct{}
+}
+
+func (t closable) Events() (<-chan alerts.Event, error) { return t.events, nil }
+func (t closable) Close()                               { close(t.closed) }
+
+// unavailable is a source that fails to subscribe.
+type unavailable struct{}
+
+func (unavailable) Events() (<-chan alerts.Event, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestMergedSubscribeFailure(t *testing.T) {
+	subscribed := closable{events: make(chan alerts.Event), closed: make(chan struct{})}
+
+	if _, err := alerts.Merge(subscribed, unavailable{}).Events(); err == nil {
+		t.Fatal("expected the merged source to fail")
+	}
+
+	select {
+	case <-subscribed.closed:
+	case <-time.After(timeout):
+		t.Fatal("expected the subscribed source to be closed")
+	}
+
+	// pending events of the subscribed source are discarded.
+	select {
+	case subscribed.events <- alerts.Event{}:
+	case <-time.After(timeout):
+		t.Fatal("expected the events of the subscribed source to be drained")
+	}
+}
+
+func TestRunMergedSources(t *testing.T) {
+	rec := systemdtest.NewRecorder()
+	servers := []*systemdtest.Server{systemdtest.NewServer(), systemdtest.NewServer()}
+	names := []string{"web1", "web2"}
+	sources := make([]alerts.EventSource, 0, len(servers))
+	for i, srv := range servers {
+		defer srv.Close()
+		srv.AddUnit("nginx.service", "active", "running")
+
+		conn, err := srv.Connection()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, alerts.NewDBusSource(conn, alerts.SourceName(names[i])))
+	}
+
+	ready := make(readiness)
+	go alerts.Run(alerts.Merge(sources...), alerts.AlertFrequency(10*time.Millisecond), alerts.AlertObserver(ready), alerts.AlertNotifiers(rec))
+
+	select {
+	case <-ready:
+	case <-time.After(timeout):
+		t.Fatal("run loop never became ready")
+	}
+
+	for _, srv := range servers {
+		srv.SetState("nginx.service", "failed", "failed")
+	}
+
+	// every batch describes a single source.
+	labels := map[string]bool{}
+	for len(labels) < len(servers) {
+		units := systemdtest.Next(rec.Alerts, timeout)
+		if units == nil {
+			t.Fatalf("expected alerts from every source, got %v", labels)
+		}
+
+		for _, unit := range units {
+			if unit.Source != units[0].Source {
+				t.Fatalf("batch mixes sources %v", units)
+			}
+			labels[unit.Label()] = true
+		}
+	}
+
+	if !labels["web1/nginx.service"] || !labels["web2/nginx.service"] {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/james-lawrence/systemd-alert/internal/config"
+	"github.com/naoina/toml/ast"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// checkConfig validates a configuration file without running the agent.
+type checkConfig struct {
+	Config    string
+	ConfigDir string
+}
+
+func (t *checkConfig) configure(cmd *kingpin.CmdClause) {
+	cmd.Arg("config", "path to the file containing the configuration").Required().ExistingFileVar(&t.Config)
+	cmd.Flag("config-dir", "directory of configuration snippets merged into the configuration, defaults to conf.d next to it").StringVar(&t.ConfigDir)
+	cmd.Action(t.execute)
+}
+
+func (t *checkConfig) execute(c *kingpin.ParseContext) error {
+	a, plugins, err := loadConfig(t.Config, t.ConfigDir)
+	if err != nil {
+		if problems, ok := err.(configError); ok {
+			for _, p := range problems {
+				fmt.Println(config.Redact(p.Error()))
+			}
+			return errors.Errorf("%d problems found", len(problems))
+		}
+
+		return err
+	}
+
+	dump(os.Stdout, a, plugins)
+
+	return nil
+}
+
+// dump the merged configuration, annotated with where each value was declared.
+func dump(w io.Writer, a agentConfig, plugins []plugin) {
+	declared := func(k string) string {
+		if o, ok := a.origins[k]; ok {
+			return o.String()
+		}
+		return "default"
+	}
+
+	fmt.Fprintln(w, "[agent]")
+	fmt.Fprintf(w, "frequency = %q # %s\n", a.Frequency, declared("frequency"))
+
+	fmt.Fprintln(w, "ignore = [")
+	for _, pattern := range a.Ignore {
+		fmt.Fprintf(w, "\t%q, # %s\n", pattern, declared("ignore."+pattern))
+	}
+	fmt.Fprintln(w, "]")
+
+	labels := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+
+	fmt.Fprintln(w, "\n[agent.labels]")
+	for _, k := range labels {
+		fmt.Fprintf(w, "%s = %q # %s\n", k, a.Labels[k], declared("labels."+k))
+	}
+
+	for _, s := range a.Sources {
+		fmt.Fprintf(w, "\n[[sources]] # %s\n", declared("sources."+s.Name))
+		fmt.Fprintf(w, "name = %q\n", s.Name)
+		if s.Type != "" {
+			fmt.Fprintf(w, "type = %q\n", s.Type)
+		}
+		if s.Address != "" {
+			fmt.Fprintf(w, "address = %s\n", config.Redact(strconv.Quote(s.Address)))
+		}
+		if len(s.Command) > 0 {
+			args := make([]string, 0, len(s.Command))
+			for _, arg := range s.Command {
+				args = append(args, strconv.Quote(arg))
+			}
+			fmt.Fprintf(w, "command = [%s]\n", config.Redact(strings.Join(args, ", ")))
+		}
+	}
+
+	for i, s := range a.Silences {
+		fmt.Fprintf(w, "\n[[silences]] # %s\n", a.silenced[i])
+		if s.Unit != "" {
+			fmt.Fprintf(w, "unit = %q\n", s.Unit)
+		}
+		if s.Host != "" {
+			fmt.Fprintf(w, "host = %q\n", s.Host)
+		}
+		if !s.Until.IsZero() {
+			fmt.Fprintf(w, "until = %s\n", s.Until.Format(time.RFC3339))
+		}
+		if s.Comment != "" {
+			fmt.Fprintf(w, "comment = %q\n", s.Comment)
+		}
+	}
+
+	for _, p := range plugins {
+		if p.File == "" {
+			fmt.Fprintf(w, "\n[[notifications.%s]] # default\n", p.Name)
+			continue
+		}
+		fmt.Fprintf(w, "\n[[notifications.%s]] # %s\n", p.Name, p.origin)
+		dumpTable(w, "notifications."+p.Name, p.File, p.section)
+	}
+}
+
+// dumpTable prints the settings of a notifier's table followed by its nested
+// tables, inline or not, each annotated with the line it was declared on.
+// values are printed as written, so secret references are shown rather than
+// the secrets they resolved to.
+func dumpTable(w io.Writer, name string, path string, tbl *ast.Table) {
+	keys := make([]string, 0, len(tbl.Fields))
+	for k := range tbl.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if kv, ok := tbl.Fields[k].(*ast.KeyValue); ok {
+			fmt.Fprintf(w, "%s = %s\n", k, config.Redact(kv.Value.Source()))
+		}
+	}
+
+	for _, k := range keys {
+		switch v := tbl.Fields[k].(type) {
+		case *ast.Table:
+			fmt.Fprintf(w, "\n[%s.%s] # %s\n", name, k, origin{path, v.Line})
+			dumpTable(w, name+"."+k, path, v)
+		case []*ast.Table:
+			for _, sub := range v {
+				fmt.Fprintf(w, "\n[[%s.%s]] # %s\n", name, k, origin{path, sub.Line})
+				dumpTable(w, name+"."+k, path, sub)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net/http"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications/forward"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// collector receives alerts forwarded by agents and fans them out through
+// its own notifiers.
+type collector struct {
+	Config      string
+	ConfigDir   string
+	Listen      string
+	CA          string
+	Certificate string
+	Key         string
+}
+
+func (t *collector) configure(cmd *kingpin.CmdClause) {
+	cmd.Flag("config", "path to the file containing the configuration").ExistingFileVar(&t.Config)
+	cmd.Flag("config-dir", "directory of configuration snippets merged into the configuration, defaults to conf.d next to it").StringVar(&t.ConfigDir)
+	cmd.Flag("listen", "address to listen on").Default(":8443").StringVar(&t.Listen)
+	cmd.Flag("ca", "certificate authority used to verify agents").Required().ExistingFileVar(&t.CA)
+	cmd.Flag("cert", "server certificate").Required().ExistingFileVar(&t.Certificate)
+	cmd.Flag("key", "server certificate key").Required().ExistingFileVar(&t.Key)
+	cmd.Action(t.execute)
+}
+
+func (t *collector) execute(c *kingpin.ParseContext) error {
+	var (
+		err      error
+		a        agentConfig
+		alerters []alerts.Notifier
+		pool     *x509.CertPool
+	)
+
+	if a, alerters, err = decodeConfig(t.Config, t.ConfigDir); err != nil {
+		return err
+	}
+
+	if pool, err = forward.CertPool(t.CA); err != nil {
+		return err
+	}
+
+	for _, n := range alerters {
+		log.Printf("running %T\n", n)
+		if s, ok := n.(alerts.Starter); ok {
+			s.Start()
+		}
+	}
+
+	ignored, silenced := alerts.IgnoreServices(a.Ignore...), forward.IgnoreSilenced(a.Silences...)
+	filter := func(unit *systemd.UnitStatus) bool {
+		return ignored(unit) && silenced(unit)
+	}
+
+	srv := &http.Server{
+		Addr:    t.Listen,
+		Handler: forward.NewCollector(filter, alerters...),
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		},
+	}
+
+	go func() {
+		log.Println("collector listening on", t.Listen)
+		if err := srv.ListenAndServeTLS(t.Certificate, t.Key); err != nil {
+			log.Fatalln(errors.Wrap(err, "collector stopped"))
+		}
+	}()
+
+	return nil
+}
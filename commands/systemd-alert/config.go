@@ -0,0 +1,587 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/config"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/forward"
+	"github.com/james-lawrence/systemd-alert/notifications/native"
+	"github.com/naoina/toml"
+	"github.com/naoina/toml/ast"
+	"github.com/pkg/errors"
+)
+
+// origin of a configuration value.
+type origin struct {
+	File string
+	Line int
+}
+
+func (t origin) String() string {
+	if t.File == "" {
+		return fmt.Sprintf("line %d", t.Line)
+	}
+
+	return fmt.Sprintf("%s:%d", t.File, t.Line)
+}
+
+// plugin is a configured notifier and where it was declared.
+type plugin struct {
+	Name string
+	origin
+	alerts.Notifier
+	Routes  []string // routes the notifier receives, every unclaimed route when empty
+	section *ast.Table
+}
+
+// problem found in a configuration file.
+type problem struct {
+	origin
+	Err error
+}
+
+func (t problem) Error() string {
+	return fmt.Sprintf("%s: %v", t.origin, t.Err)
+}
+
+// configError collects every problem found in the configuration files.
+type configError []problem
+
+func (t configError) Error() string {
+	lines := make([]string, 0, len(t))
+	for _, p := range t {
+		lines = append(lines, p.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configFiles returns the configuration file followed by the snippets in the
+// directory in lexical order. the directory defaults to conf.d next to the
+// configuration file.
+func configFiles(path, dir string) (files []string, err error) {
+	if _, err = os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	if dir == "" && path != "" {
+		dir = filepath.Join(filepath.Dir(path), "conf.d")
+	}
+
+	if dir == "" {
+		return files, nil
+	}
+
+	snippets, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return files, errors.Wrapf(err, "failed to read %s", dir)
+	}
+
+	return append(files, snippets...), nil
+}
+
+func decodeConfig(path, dir string) (a agentConfig, alerters []alerts.Notifier, err error) {
+	var (
+		notifiers []declared
+	)
+
+	if a, notifiers, err = declareConfig(path, dir); err != nil {
+		return a, alerters, err
+	}
+
+	return a, alertersOf(notifiers), nil
+}
+
+// declareConfig decodes the configuration, identifying every notifier by how
+// it was declared.
+func declareConfig(path, dir string) (a agentConfig, notifiers []declared, err error) {
+	var (
+		plugins []plugin
+	)
+
+	if a, plugins, err = loadConfig(path, dir); err != nil {
+		return a, notifiers, err
+	}
+
+	return a, routeNotifiers(plugins), nil
+}
+
+// declared is a notifier along with the declaration it was created from,
+// including its routing and resolved secrets.
+type declared struct {
+	alerts.Notifier
+	declaration string
+}
+
+func alertersOf(notifiers []declared) []alerts.Notifier {
+	alerters := make([]alerts.Notifier, 0, len(notifiers))
+	for _, d := range notifiers {
+		alerters = append(alerters, d.Notifier)
+	}
+	return alerters
+}
+
+// keep replaces the declared notifiers with the running notifiers declared
+// the same way, so notifiers unchanged by a reload keep their state.
+func keep(running, notifiers []declared) []declared {
+	available := make(map[string][]declared, len(running))
+	for _, d := range running {
+		available[d.declaration] = append(available[d.declaration], d)
+	}
+
+	kept := make([]declared, 0, len(notifiers))
+	for _, d := range notifiers {
+		if previous := available[d.declaration]; len(previous) > 0 {
+			d, available[d.declaration] = previous[0], previous[1:]
+		}
+		kept = append(kept, d)
+	}
+
+	return kept
+}
+
+// routeNotifiers restricts notifiers declaring routes to the units of those
+// routes, the remaining notifiers receive the units of every other route.
+func routeNotifiers(plugins []plugin) (notifiers []declared) {
+	var (
+		claimed []string
+	)
+
+	for _, p := range plugins {
+		claimed = append(claimed, p.Routes...)
+	}
+
+	for _, p := range plugins {
+		declaration := p.Name + "\n" + fingerprint(p.section)
+
+		switch {
+		case len(claimed) == 0:
+			notifiers = append(notifiers, declared{Notifier: p.Notifier, declaration: declaration})
+		case len(p.Routes) > 0:
+			notifiers = append(notifiers, declared{Notifier: alerts.Route(p.Notifier, p.Routes...), declaration: declaration})
+		default:
+			declaration += fmt.Sprintf("unrouted = %q\n", claimed)
+			notifiers = append(notifiers, declared{Notifier: alerts.Unrouted(p.Notifier, claimed...), declaration: declaration})
+		}
+	}
+
+	return notifiers
+}
+
+// fingerprint renders the table with its secrets resolved, so rotating a
+// secret changes the fingerprint even though its reference is unchanged.
+func fingerprint(tbl *ast.Table) string {
+	var (
+		b strings.Builder
+	)
+
+	if tbl == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tbl.Fields))
+	for k := range tbl.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", k, fingerprintValue(tbl.Fields[k]))
+	}
+
+	return b.String()
+}
+
+func fingerprintValue(v interface{}) string {
+	switch v := v.(type) {
+	case *ast.KeyValue:
+		return fingerprintValue(v.Value)
+	case *ast.Table:
+		return "{\n" + fingerprint(v) + "}"
+	case []*ast.Table:
+		values := make([]string, 0, len(v))
+		for _, t := range v {
+			values = append(values, fingerprintValue(t))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case *ast.String:
+		return strconv.Quote(v.Value)
+	case *ast.Array:
+		values := make([]string, 0, len(v.Value))
+		for _, e := range v.Value {
+			values = append(values, fingerprintValue(e))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case ast.Value:
+		return v.Source()
+	}
+
+	return ""
+}
+
+// loadConfig merges the configuration file with the snippets in the
+// directory. notifications, sources and silences append, agent settings override and
+// ignore lists union.
+func loadConfig(path, dir string) (a agentConfig, plugins []plugin, err error) {
+	var (
+		files    []string
+		problems configError
+	)
+
+	if files, err = configFiles(path, dir); err != nil {
+		return a, plugins, err
+	}
+
+	if len(files) == 0 {
+		a = agentConfig{Frequency: time.Second}
+		plugins = append(plugins, plugin{Name: "default", Notifier: native.DefaultAlerter()})
+		return a, plugins, nil
+	}
+
+	for _, path := range files {
+		var (
+			tbl      *ast.Table
+			fa       agentConfig
+			fplugins []plugin
+			found    configError
+		)
+
+		if tbl, err = config.Decode(path); err != nil {
+			return a, plugins, err
+		}
+
+		fa, fplugins, found = decodeFile(path, tbl)
+
+		sort.SliceStable(found, func(i, j int) bool { return found[i].Line < found[j].Line })
+		problems = append(problems, found...)
+		problems = append(problems, a.merge(fa)...)
+		plugins = append(plugins, fplugins...)
+	}
+
+	if len(problems) > 0 {
+		return a, plugins, problems
+	}
+
+	if a.Frequency == 0 {
+		a.Frequency = time.Second
+	}
+
+	if len(plugins) == 0 {
+		if a := native.DefaultAlerter(); a != nil {
+			plugins = append(plugins, plugin{Name: "default", Notifier: a})
+		}
+	}
+
+	return a, plugins, nil
+}
+
+func decodeFile(path string, tbl *ast.Table) (a agentConfig, plugins []plugin, problems configError) {
+	for name, v := range tbl.Fields {
+		switch name {
+		case "agent", "sources", "silences", "notifications":
+		default:
+			problems = append(problems, problem{origin{path, line(v)}, errors.Errorf("unknown section %s", name)})
+		}
+	}
+
+	// the agent must be decoded before the sources it holds.
+	if v, ok := tbl.Fields["agent"]; ok {
+		problems = append(problems, decodeAgent(path, v, &a)...)
+	}
+
+	if v, ok := tbl.Fields["sources"]; ok {
+		problems = append(problems, decodeSources(path, v, &a)...)
+	}
+
+	if v, ok := tbl.Fields["silences"]; ok {
+		problems = append(problems, decodeSilences(path, v, &a)...)
+	}
+
+	if v, ok := tbl.Fields["notifications"]; ok {
+		var decoded configError
+		plugins, decoded = decodeNotifications(path, v)
+		problems = append(problems, decoded...)
+	}
+
+	return a, plugins, problems
+}
+
+func decodeAgent(path string, v interface{}, a *agentConfig) (problems configError) {
+	tbl, ok := v.(*ast.Table)
+	if !ok {
+		return configError{{origin{path, line(v)}, errors.New("agent must be a table")}}
+	}
+
+	if err := toml.UnmarshalTable(tbl, a); err != nil {
+		return configError{lineError(path, tbl, "invalid agent configuration", err)}
+	}
+
+	a.origins = make(map[string]origin)
+	if a.Frequency != 0 {
+		a.origins["frequency"] = origin{path, line(tbl.Fields["frequency"])}
+	}
+
+	for _, pattern := range a.Ignore {
+		o := origin{path, line(tbl.Fields["ignore"])}
+		if err := alerts.ValidPattern(pattern); err != nil {
+			problems = append(problems, problem{o, errors.Errorf("invalid ignore pattern %q: %v", pattern, err)})
+		}
+		a.origins["ignore."+pattern] = o
+	}
+
+	for k := range a.Labels {
+		o := origin{path, line(tbl.Fields["labels"])}
+		if labels, ok := tbl.Fields["labels"].(*ast.Table); ok {
+			o.Line = line(labels.Fields[k])
+		}
+		a.origins["labels."+k] = o
+	}
+
+	return problems
+}
+
+func decodeSources(path string, v interface{}, a *agentConfig) (problems configError) {
+	tables, ok := v.([]*ast.Table)
+	if !ok {
+		return configError{{origin{path, line(v)}, errors.New("sources must be an array of tables, e.g. [[sources]]")}}
+	}
+
+	if a.origins == nil {
+		a.origins = make(map[string]origin)
+	}
+
+	for _, tbl := range tables {
+		var s sourceConfig
+		if err := toml.UnmarshalTable(tbl, &s); err != nil {
+			problems = append(problems, lineError(path, tbl, "invalid source configuration", err))
+			continue
+		}
+
+		if s.Name == "" {
+			problems = append(problems, problem{origin{path, tbl.Line}, errors.New("source is missing a name")})
+			continue
+		}
+
+		switch s.Type {
+		case "", "bus", "machined", "logind":
+		default:
+			problems = append(problems, problem{origin{path, tbl.Line}, errors.Errorf("source %s has an unknown type %q", s.Name, s.Type)})
+			continue
+		}
+
+		a.Sources = append(a.Sources, s)
+		a.origins["sources."+s.Name] = origin{path, tbl.Line}
+	}
+
+	return problems
+}
+
+func decodeSilences(path string, v interface{}, a *agentConfig) (problems configError) {
+	tables, ok := v.([]*ast.Table)
+	if !ok {
+		return configError{{origin{path, line(v)}, errors.New("silences must be an array of tables, e.g. [[silences]]")}}
+	}
+
+	for _, tbl := range tables {
+		var s forward.Silence
+		if err := toml.UnmarshalTable(tbl, &s); err != nil {
+			problems = append(problems, lineError(path, tbl, "invalid silence", err))
+			continue
+		}
+
+		if s.Unit == "" && s.Host == "" {
+			problems = append(problems, problem{origin{path, tbl.Line}, errors.New("silence must match a unit or a host")})
+			continue
+		}
+
+		if err := alerts.ValidPattern(s.Unit); err != nil {
+			problems = append(problems, problem{origin{path, tbl.Line}, errors.Errorf("invalid silence unit pattern %q: %v", s.Unit, err)})
+			continue
+		}
+
+		if err := alerts.ValidPattern(s.Host); err != nil {
+			problems = append(problems, problem{origin{path, tbl.Line}, errors.Errorf("invalid silence host pattern %q: %v", s.Host, err)})
+			continue
+		}
+
+		a.Silences = append(a.Silences, s)
+		a.silenced = append(a.silenced, origin{path, tbl.Line})
+	}
+
+	return problems
+}
+
+func decodeNotifications(path string, v interface{}) (plugins []plugin, problems configError) {
+	tbl, ok := v.(*ast.Table)
+	if !ok {
+		return plugins, configError{{origin{path, line(v)}, errors.New("notifications must be a table")}}
+	}
+
+	names := make([]string, 0, len(tbl.Fields))
+	for name := range tbl.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var (
+			ok     bool
+			create func() alerts.Notifier
+			tables []*ast.Table
+		)
+
+		if create, ok = notifications.Plugins[name]; !ok {
+			problems = append(problems, problem{origin{path, line(tbl.Fields[name])}, errors.Errorf("unknown notification %s", name)})
+			continue
+		}
+
+		if tables, ok = tbl.Fields[name].([]*ast.Table); !ok {
+			problems = append(problems, problem{origin{path, line(tbl.Fields[name])}, errors.Errorf("notification %s must be an array of tables, e.g. [[notifications.%s]]", name, name)})
+			continue
+		}
+
+		log.Println("loading plugin", name)
+		for _, section := range tables {
+			if err := config.ResolveSecrets(section); err != nil {
+				problems = append(problems, lineError(path, section, "invalid "+name+" notification", err))
+				continue
+			}
+
+			routes, settings, err := decodeRoutes(section)
+			if err != nil {
+				problems = append(problems, lineError(path, section, "invalid "+name+" notification", err))
+				continue
+			}
+
+			x := create()
+			if err := toml.UnmarshalTable(settings, x); err != nil {
+				problems = append(problems, lineError(path, section, "invalid "+name+" notification", err))
+				continue
+			}
+
+			if v, ok := x.(notifications.Validator); ok {
+				if err := v.Validate(); err != nil {
+					problems = append(problems, problem{origin{path, section.Line}, err})
+					continue
+				}
+			}
+
+			plugins = append(plugins, plugin{Name: name, origin: origin{path, section.Line}, Notifier: x, Routes: routes, section: section})
+		}
+	}
+
+	return plugins, problems
+}
+
+// decodeRoutes separates the routes every notification accepts from the
+// settings of the notifier itself.
+func decodeRoutes(section *ast.Table) (routes []string, settings *ast.Table, err error) {
+	var (
+		dec struct {
+			Routes []string
+		}
+	)
+
+	v, ok := section.Fields["routes"]
+	if !ok {
+		return nil, section, nil
+	}
+
+	if err = toml.UnmarshalTable(&ast.Table{Fields: map[string]interface{}{"routes": v}}, &dec); err != nil {
+		return nil, section, err
+	}
+
+	copied := *section
+	copied.Fields = make(map[string]interface{}, len(section.Fields))
+	for k, v := range section.Fields {
+		if k != "routes" {
+			copied.Fields[k] = v
+		}
+	}
+
+	return dec.Routes, &copied, nil
+}
+
+// merge the settings of a later configuration file. scalars and labels
+// override, ignore lists union and sources and silences append.
+func (t *agentConfig) merge(o agentConfig) (problems configError) {
+	if t.origins == nil {
+		t.origins = make(map[string]origin)
+	}
+
+	if o.Frequency != 0 {
+		t.Frequency = o.Frequency
+		t.origins["frequency"] = o.origins["frequency"]
+	}
+
+	for k, v := range o.Labels {
+		if t.Labels == nil {
+			t.Labels = make(map[string]string)
+		}
+		t.Labels[k] = v
+		t.origins["labels."+k] = o.origins["labels."+k]
+	}
+
+	for _, pattern := range o.Ignore {
+		if _, ok := t.origins["ignore."+pattern]; ok {
+			continue
+		}
+		t.Ignore = append(t.Ignore, pattern)
+		t.origins["ignore."+pattern] = o.origins["ignore."+pattern]
+	}
+
+	t.Silences = append(t.Silences, o.Silences...)
+	t.silenced = append(t.silenced, o.silenced...)
+
+	for _, s := range o.Sources {
+		k := "sources." + s.Name
+		if previous, ok := t.origins[k]; ok {
+			problems = append(problems, problem{o.origins[k], errors.Errorf("source %s is already defined at %s", s.Name, previous)})
+			continue
+		}
+		t.Sources = append(t.Sources, s)
+		t.origins[k] = o.origins[k]
+	}
+
+	return problems
+}
+
+// lineError locates the error on the line it occurred on, falling back to
+// the line of the table.
+func lineError(path string, tbl *ast.Table, msg string, err error) problem {
+	at := tbl.Line
+	if le, ok := err.(*toml.LineError); ok {
+		at, err = le.Line, le.Err
+	}
+
+	// problems with a setting are reported on the line of its key.
+	if ke, ok := errors.Cause(err).(notifications.KeyError); ok && line(tbl.Fields[ke.Key]) > 0 {
+		at, err = line(tbl.Fields[ke.Key]), ke.Err
+	}
+
+	return problem{origin{path, at}, errors.Wrap(err, msg)}
+}
+
+// line of the configuration a decoded value was declared on.
+func line(v interface{}) int {
+	switch v := v.(type) {
+	case *ast.Table:
+		return v.Line
+	case []*ast.Table:
+		if len(v) > 0 {
+			return v[0].Line
+		}
+	case *ast.KeyValue:
+		return v.Line
+	}
+
+	return 0
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.toml")
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigReportsProblems(t *testing.T) {
+	path := writeConfig(t, `[agent]
+frequency = "1s"
+ignore = ["bad[.service"]
+
+[bogus]
+
+[[sources]]
+type = "bus"
+
+[[notifications.slak]]
+
+[[notifications.slack]]
+channel = "#ops"
+
+[[notifications.debug]]
+color = "red"
+`)
+
+	_, _, err := loadConfig(path, "")
+	problems, ok := err.(configError)
+	if !ok {
+		t.Fatalf("expected configuration problems, got %v", err)
+	}
+
+	expected := []int{3, 5, 7, 10, 12, 16}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, got:\n%v", len(expected), problems)
+	}
+
+	for i, line := range expected {
+		if problems[i].Line != line {
+			t.Errorf("expected problem %d on line %d, got: %v", i, line, problems[i])
+		}
+	}
+}
+
+func TestLoadConfigAgentFrequency(t *testing.T) {
+	path := writeConfig(t, `[agent]
+ignore = ["user@*.service"]
+frequency = "often"
+`)
+
+	_, _, err := loadConfig(path, "")
+	if problems, ok := err.(configError); !ok || len(problems) != 1 || problems[0].Line != 3 {
+		t.Fatalf("expected the invalid frequency to be reported on its line, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `[agent]
+ignore = ["user@*.service"]
+
+[[sources]]
+name = "containers"
+type = "machined"
+
+[[notifications.debug]]
+`)
+
+	a, plugins, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Frequency == 0 {
+		t.Error("expected the frequency to default")
+	}
+
+	if len(a.Sources) != 1 || a.Sources[0].Name != "containers" {
+		t.Errorf("unexpected sources %v", a.Sources)
+	}
+
+	if len(plugins) != 1 || plugins[0].Name != "debug" || plugins[0].Line != 8 {
+		t.Errorf("unexpected notifiers %v", plugins)
+	}
+}
+
+func TestLoadConfigMergesSnippets(t *testing.T) {
+	path := writeConfig(t, `[agent]
+frequency = "10s"
+ignore = ["a.service", "b.service"]
+
+[agent.labels]
+env = "production"
+team = "platform"
+
+[[notifications.debug]]
+`)
+
+	dir := filepath.Join(filepath.Dir(path), "conf.d")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	snippets := map[string]string{
+		"10-team.toml": `[agent]
+frequency = "30s"
+ignore = ["b.service", "c.service"]
+
+[agent.labels]
+team = "storage"
+
+[[notifications.debug]]
+`,
+		"20-sources.toml": `[[sources]]
+name = "containers"
+type = "machined"
+`,
+		"ignored.conf": `[bogus]`,
+	}
+
+	for name, content := range snippets {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, plugins, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Frequency != 30*time.Second {
+		t.Errorf("expected the snippet to override the frequency, got %s", a.Frequency)
+	}
+
+	if !reflect.DeepEqual(a.Ignore, []string{"a.service", "b.service", "c.service"}) {
+		t.Errorf("expected the ignore lists to union, got %v", a.Ignore)
+	}
+
+	if !reflect.DeepEqual(a.Labels, map[string]string{"env": "production", "team": "storage"}) {
+		t.Errorf("expected the labels to merge, got %v", a.Labels)
+	}
+
+	if len(a.Sources) != 1 || len(plugins) != 2 {
+		t.Errorf("expected sources and notifications to append, got %v %v", a.Sources, plugins)
+	}
+
+	if o := a.origins["labels.team"]; o.File != filepath.Join(dir, "10-team.toml") || o.Line != 6 {
+		t.Errorf("unexpected origin for the team label %s", o)
+	}
+}
+
+func TestLoadConfigRoutes(t *testing.T) {
+	path := writeConfig(t, `[[notifications.debug]]
+routes = ["web", "db"]
+
+[[notifications.debug]]
+`)
+
+	_, plugins, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plugins) != 2 || !reflect.DeepEqual(plugins[0].Routes, []string{"web", "db"}) || len(plugins[1].Routes) != 0 {
+		t.Fatalf("unexpected routes %v", plugins)
+	}
+
+	if _, ok := plugins[0].section.Fields["routes"]; !ok {
+		t.Error("expected the routes to remain in the declared section")
+	}
+
+	if _, alerters, err := decodeConfig(path, ""); err != nil || len(alerters) != 2 {
+		t.Errorf("unexpected notifiers %v %v", alerters, err)
+	}
+}
+
+func TestLoadConfigSilences(t *testing.T) {
+	path := writeConfig(t, `[[silences]]
+unit = "nginx.service"
+host = "web*"
+until = 2026-11-01T00:00:00Z
+comment = "maintenance"
+
+[[silences]]
+host = "db1"
+
+[[silences]]
+comment = "matches nothing"
+
+[[silences]]
+unit = "bad[.service"
+`)
+
+	_, _, err := loadConfig(path, "")
+	problems, ok := err.(configError)
+	if !ok || len(problems) != 2 || problems[0].Line != 10 || problems[1].Line != 13 {
+		t.Fatalf("expected problems on lines 10 and 13, got %v", err)
+	}
+
+	path = writeConfig(t, `[[silences]]
+unit = "nginx.service"
+host = "web*"
+until = 2026-11-01T00:00:00Z
+comment = "maintenance"
+
+[[silences]]
+host = "db1"
+`)
+
+	a, _, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	if len(a.Silences) != 2 || a.Silences[0].Host != "web*" || !a.Silences[0].Until.Equal(until) || a.Silences[1].Host != "db1" {
+		t.Fatalf("unexpected silences %+v", a.Silences)
+	}
+
+	if len(a.silenced) != 2 || a.silenced[1].Line != 7 {
+		t.Errorf("unexpected silence origins %v", a.silenced)
+	}
+}
+
+func TestReloadKeepsUnchangedNotifiers(t *testing.T) {
+	path := writeConfig(t, "")
+	secret := filepath.Join(filepath.Dir(path), "token")
+
+	reload := func(config, token string) []declared {
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(secret, []byte(token), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, notifiers, err := declareConfig(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return notifiers
+	}
+
+	config := `[[notifications.debug]]
+
+[[notifications.webhook]]
+url = "https://a.example.com"
+token = "file:` + secret + `"
+`
+
+	running := reload(config, "t0ken")
+	kept := keep(running, reload(config, "t0ken"))
+	if len(kept) != 2 || kept[0].Notifier != running[0].Notifier || kept[1].Notifier != running[1].Notifier {
+		t.Fatal("expected unchanged notifiers to be kept")
+	}
+
+	kept = keep(running, reload(config, "r0tated"))
+	if kept[0].Notifier != running[0].Notifier || kept[1].Notifier == running[1].Notifier {
+		t.Error("expected a rotated secret to replace the notifier")
+	}
+
+	kept = keep(running, reload(strings.Replace(config, "a.example.com", "b.example.com", 1), "t0ken"))
+	if kept[0].Notifier != running[0].Notifier || kept[1].Notifier == running[1].Notifier {
+		t.Error("expected a changed setting to replace the notifier")
+	}
+
+	// routing the webhook changes what the debug notifier receives.
+	kept = keep(running, reload(strings.Replace(config, "token =", "routes = [\"web\"]\ntoken =", 1), "t0ken"))
+	if kept[0].Notifier == running[0].Notifier || kept[1].Notifier == running[1].Notifier {
+		t.Error("expected notifiers with changed routes to be replaced")
+	}
+}
+
+func TestDumpSources(t *testing.T) {
+	var (
+		buf bytes.Buffer
+	)
+
+	path := writeConfig(t, `[[sources]]
+name = "remote"
+address = "tcp:host=example.com,port=5555"
+
+[[sources]]
+name = "bastion"
+command = ["ssh", "web1", "systemd-stdio-bridge"]
+`)
+
+	a, plugins, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump(&buf, a, plugins)
+
+	for _, expected := range []string{
+		"[[sources]] # " + path + ":1\nname = \"remote\"\naddress = \"tcp:host=example.com,port=5555\"\n",
+		"[[sources]] # " + path + ":5\nname = \"bastion\"\ncommand = [\"ssh\", \"web1\", \"systemd-stdio-bridge\"]\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected the dump to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestLoadConfigTemplateVariables(t *testing.T) {
+	path := writeConfig(t, `[[notifications.webhook]]
+url = "https://hooks.example.com"
+body = '{{ range $i, $u := .Units }}{{ if $i }}, {{ end }}{{ $u.Label }}{{ end }}'
+`)
+
+	if _, _, err := loadConfig(path, ""); err != nil {
+		t.Fatalf("expected template variables to survive loading, got %v", err)
+	}
+
+	path = writeConfig(t, `[[notifications.webhook]]
+url = "https://hooks.example.com"
+body = '{{ range .Units }}'
+`)
+
+	_, _, err := loadConfig(path, "")
+	if problems, ok := err.(configError); !ok || len(problems) != 1 || problems[0].Line != 3 {
+		t.Fatalf("expected the invalid template to be reported on its line, got %v", err)
+	}
+}
+
+func TestLoadConfigEmailTemplateVariables(t *testing.T) {
+	path := writeConfig(t, `[[notifications.email]]
+address = "smtp.example.com:25"
+from = "alerts@example.com"
+to = ["ops@example.com"]
+subject = '{{ $h := .Host.Hostname }}{{ .Status }}: {{ $h }}'
+text = '{{ range $i, $u := .Units }}{{ if $i }}, {{ end }}{{ $u.Label }}{{ end }}'
+html = '<ul>{{ range $u := .Units }}<li>{{ $u.Label }}</li>{{ end }}</ul>'
+`)
+
+	if _, _, err := loadConfig(path, ""); err != nil {
+		t.Fatalf("expected template variables to survive loading, got %v", err)
+	}
+
+	path = writeConfig(t, `[[notifications.email]]
+address = "smtp.example.com:25"
+from = "alerts@example.com"
+to = ["ops@example.com"]
+subject = "{{ .Status }}"
+html = '{{ range $u := .Units }}'
+`)
+
+	_, _, err := loadConfig(path, "")
+	if problems, ok := err.(configError); !ok || len(problems) != 1 || problems[0].Line != 6 {
+		t.Fatalf("expected the invalid template to be reported on its line, got %v", err)
+	}
+}
+
+func TestDumpNestedTables(t *testing.T) {
+	var (
+		buf bytes.Buffer
+	)
+
+	setenv(t, "WEBHOOK_TOKEN", "hunter2")
+
+	path := writeConfig(t, `[[notifications.webhook]]
+url = "https://hooks.example.com/a"
+headers = { Authorization = "env:WEBHOOK_TOKEN" }
+
+[[notifications.webhook]]
+url = "https://hooks.example.com/b"
+
+[notifications.webhook.headers]
+X-Team = "platform"
+`)
+
+	a, plugins, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump(&buf, a, plugins)
+
+	for _, expected := range []string{
+		"url = \"https://hooks.example.com/a\"\n\n[notifications.webhook.headers] # " + path + ":3\nAuthorization = \"env:WEBHOOK_TOKEN\"\n",
+		"url = \"https://hooks.example.com/b\"\n\n[notifications.webhook.headers] # " + path + ":8\nX-Team = \"platform\"\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected the dump to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
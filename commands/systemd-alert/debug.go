@@ -11,6 +11,7 @@ import (
 
 type debugAlert struct {
 	uconn, conn *systemd.Conn
+	health      *health
 	Frequency   time.Duration
 }
 
@@ -20,7 +21,11 @@ func (t *debugAlert) configure(cmd *kingpin.CmdClause) {
 }
 
 func (t *debugAlert) execute(c *kingpin.ParseContext) error {
-	go alerts.Run(t.conn, alerts.AlertNotifiers(debug.NewAlerter()), alerts.AlertFrequency(t.Frequency))
-	go alerts.SafeRun(t.uconn, alerts.AlertNotifiers(debug.NewAlerter()), alerts.AlertFrequency(t.Frequency))
+	if t.conn == nil {
+		return errUnavailable
+	}
+
+	go alerts.Run(alerts.NewDBusSource(t.conn), alerts.AlertNotifiers(debug.NewAlerter()), alerts.AlertFrequency(t.Frequency), alerts.AlertObserver(t.health.observer("system", t.conn)))
+	go alerts.SafeRun(t.uconn, alerts.AlertNotifiers(debug.NewAlerter()), alerts.AlertFrequency(t.Frequency), alerts.AlertObserver(t.health.observer("user", t.uconn)))
 	return nil
 }
@@ -3,99 +3,111 @@ package main
 import (
 	"log"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	alerts "github.com/james-lawrence/systemd-alert"
-	"github.com/james-lawrence/systemd-alert/internal/config"
-	"github.com/james-lawrence/systemd-alert/notifications"
-	"github.com/james-lawrence/systemd-alert/notifications/native"
 	"github.com/james-lawrence/systemd-alert/systemd"
-	"github.com/naoina/toml"
-	"github.com/naoina/toml/ast"
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
 	// load native into the registry.
 	_ "github.com/james-lawrence/systemd-alert/notifications/debug"
+	_ "github.com/james-lawrence/systemd-alert/notifications/discord"
+	_ "github.com/james-lawrence/systemd-alert/notifications/email"
+	_ "github.com/james-lawrence/systemd-alert/notifications/forward"
+	_ "github.com/james-lawrence/systemd-alert/notifications/gotify"
 	_ "github.com/james-lawrence/systemd-alert/notifications/influxdb"
+	_ "github.com/james-lawrence/systemd-alert/notifications/matrix"
 	_ "github.com/james-lawrence/systemd-alert/notifications/native"
+	_ "github.com/james-lawrence/systemd-alert/notifications/ntfy"
+	_ "github.com/james-lawrence/systemd-alert/notifications/opsgenie"
+	_ "github.com/james-lawrence/systemd-alert/notifications/pagerduty"
 	_ "github.com/james-lawrence/systemd-alert/notifications/slack"
+	_ "github.com/james-lawrence/systemd-alert/notifications/teams"
+	_ "github.com/james-lawrence/systemd-alert/notifications/telegram"
+	_ "github.com/james-lawrence/systemd-alert/notifications/textfile"
+	_ "github.com/james-lawrence/systemd-alert/notifications/webhook"
 )
 
 type _default struct {
-	conn   *systemd.Conn
-	uconn  *systemd.Conn
-	Config string
+	conn      *systemd.Conn
+	uconn     *systemd.Conn
+	health    *health
+	Config    string
+	ConfigDir string
 }
 
 func (t *_default) configure(cmd *kingpin.CmdClause) {
 	cmd.Flag("config", "path to the file containing the configuration").ExistingFileVar(&t.Config)
+	cmd.Flag("config-dir", "directory of configuration snippets merged into the configuration, defaults to conf.d next to it").StringVar(&t.ConfigDir)
 	cmd.Action(t.execute)
 }
 
 func (t *_default) execute(c *kingpin.ParseContext) error {
 	var (
-		err      error
-		a        agentConfig
-		alerters []alerts.Notifier
+		err       error
+		a         agentConfig
+		notifiers []declared
 	)
 
-	if a, alerters, err = decodeConfig(t.Config); err != nil {
+	if t.conn == nil {
+		return errUnavailable
+	}
+
+	if a, notifiers, err = declareConfig(t.Config, t.ConfigDir); err != nil {
 		return err
 	}
 
-	go alerts.Run(t.conn,
-		alerts.AlertNotifiers(alerters...),
-		alerts.AlertFrequency(a.Frequency),
-		alerts.AlertIgnoreServices(a.Ignore...),
-	)
+	settings := alerts.NewSettings(a.Ignore, alertersOf(notifiers)...)
 
-	go alerts.SafeRun(t.uconn,
-		alerts.AlertNotifiers(alerters...),
+	go alerts.Run(alerts.NewDBusSource(t.conn, alerts.SourceLabels(a.Labels), alerts.SourceUnitFiles("/")),
+		alerts.AlertSettings(settings),
 		alerts.AlertFrequency(a.Frequency),
-		alerts.AlertIgnoreServices(a.Ignore...),
+		alerts.AlertObserver(t.health.observer("system", t.conn)),
 	)
-	return nil
-}
 
-func decodeConfig(path string) (a agentConfig, alerters []alerts.Notifier, err error) {
-	if _, err = os.Stat(path); os.IsNotExist(err) {
-		a = agentConfig{Frequency: time.Second}
-		alerters = append(alerters, native.DefaultAlerter())
-		return a, alerters, nil
+	if t.uconn != nil {
+		go alerts.Run(alerts.NewDBusSource(t.uconn, alerts.SourceLabels(a.Labels), alerts.SourceUnitFiles("/")),
+			alerts.AlertSettings(settings),
+			alerts.AlertFrequency(a.Frequency),
+			alerts.AlertObserver(t.health.observer("user", t.uconn)),
+		)
 	}
 
-	tbl := config.Decode(path)
-
-	if err = toml.UnmarshalTable(tbl.Fields["agent"].(*ast.Table), &a); err != nil {
-		return a, alerters, errors.Wrap(err, "failed to parse agent configuration")
+	for _, s := range a.Sources {
+		go s.run(a, settings)
 	}
 
-	for name, configs := range tbl.Fields["notifications"].(*ast.Table).Fields {
-		var (
-			ok     bool
-			plugin func() alerts.Notifier
-		)
+	go t.reloads(settings, notifiers)
+
+	return nil
+}
 
-		if plugin, ok = notifications.Plugins[name]; !ok {
-			continue
+// reloads the ignore list, routes and notifiers on SIGHUP, keeping the
+// current ones if the configuration is invalid. notifiers whose declaration
+// is unchanged keep running along with their state. the frequency, labels and
+// sources require a restart.
+func (t *_default) reloads(settings *alerts.Settings, running []declared) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		log.Println("reloading configuration", t.Config)
+		if err := systemd.Notify("RELOADING=1"); err != nil {
+			log.Println(err)
 		}
 
-		log.Println("loading plugin", name)
-		for _, config := range configs.([]*ast.Table) {
-			x := plugin()
-			if err = toml.UnmarshalTable(config, x); err != nil {
-				log.Println("failed to load plugin", name, "line:", config.Line, err)
-				continue
-			}
-			alerters = append(alerters, x)
+		if a, notifiers, err := declareConfig(t.Config, t.ConfigDir); err != nil {
+			log.Println(errors.Wrap(err, "keeping the current configuration"))
+		} else {
+			running = keep(running, notifiers)
+			settings.Reload(a.Ignore, alertersOf(running)...)
+			log.Println("configuration reloaded")
 		}
-	}
 
-	if len(alerters) == 0 {
-		if a := native.DefaultAlerter(); a != nil {
-			alerters = append(alerters, a)
+		if err := systemd.Notify("READY=1"); err != nil {
+			log.Println(err)
 		}
 	}
-	return a, alerters, nil
 }
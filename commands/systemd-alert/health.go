@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+func newHealth() *health {
+	watchdog, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Println(err)
+	}
+
+	return &health{
+		m:        &sync.Mutex{},
+		loops:    make(map[string]*loopHealth),
+		watchdog: watchdog,
+	}
+}
+
+type loopHealth struct {
+	ready    bool
+	progress time.Time
+	watched  int
+	active   int
+}
+
+// health aggregates the progress of every event loop and reports it to the
+// service manager using the sd_notify protocol.
+type health struct {
+	m        *sync.Mutex
+	loops    map[string]*loopHealth
+	ready    bool
+	watchdog time.Duration
+}
+
+// observer registers an event loop for the given connection. loops without a
+// connection never run, so they are not waited on.
+func (t *health) observer(name string, conn *systemd.Conn) alerts.Observer {
+	if conn == nil {
+		return loopObserver{}
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.loops[name] = &loopHealth{}
+
+	return loopObserver{name: name, health: t}
+}
+
+func (t *health) update(name string, fn func(*loopHealth)) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if l, ok := t.loops[name]; ok {
+		fn(l)
+	}
+
+	if t.ready {
+		return
+	}
+
+	for _, l := range t.loops {
+		if !l.ready {
+			return
+		}
+	}
+
+	t.ready = true
+	if err := systemd.Notify("READY=1"); err != nil {
+		log.Println(err)
+	}
+}
+
+// healthy reports whether every loop has made progress within the window.
+func (t *health) healthy(window time.Duration) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if !t.ready {
+		return false
+	}
+
+	for _, l := range t.loops {
+		if time.Since(l.progress) > window {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t *health) status() string {
+	var (
+		watched, active int
+	)
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, l := range t.loops {
+		watched += l.watched
+		active += l.active
+	}
+
+	return fmt.Sprintf("STATUS=watching %d units, %d active alerts", watched, active)
+}
+
+// window the loops must make progress within for the watchdog to be pinged.
+func (t *health) window() time.Duration {
+	return t.watchdog / 2
+}
+
+// heartbeat is how often the loops report progress, often enough that a loop
+// is never considered stalled between two reports.
+func (t *health) heartbeat() time.Duration {
+	if t.watchdog == 0 || t.window()/4 > time.Second {
+		return time.Second
+	}
+
+	return t.window() / 4
+}
+
+// run periodically reports status and, while every loop is making progress,
+// pings the watchdog.
+func (t *health) run(ctx context.Context) {
+	var (
+		err error
+	)
+
+	interval := 5 * time.Second
+	if t.watchdog > 0 && t.window() < interval {
+		interval = t.window()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err = systemd.Notify(t.status()); err != nil {
+				log.Println(err)
+			}
+
+			if t.watchdog == 0 {
+				continue
+			}
+
+			if !t.healthy(t.window()) {
+				log.Println("event loops are not making progress, withholding watchdog ping")
+				continue
+			}
+
+			if err = systemd.Notify("WATCHDOG=1"); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+type loopObserver struct {
+	name   string
+	health *health
+}
+
+func (t loopObserver) Ready() {
+	if t.health == nil {
+		return
+	}
+
+	t.health.update(t.name, func(l *loopHealth) {
+		l.ready = true
+		l.progress = time.Now()
+	})
+}
+
+func (t loopObserver) Progress(watched, active int) {
+	if t.health == nil {
+		return
+	}
+
+	t.health.update(t.name, func(l *loopHealth) {
+		l.progress = time.Now()
+		l.watched = watched
+		l.active = active
+	})
+}
+
+func (t loopObserver) Heartbeat() time.Duration {
+	if t.health == nil {
+		return 0
+	}
+
+	return t.health.heartbeat()
+}
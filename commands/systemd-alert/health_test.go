@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// setenv sets the environment variable for the duration of the test.
+func setenv(t *testing.T, key, value string) {
+	previous, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// notifySocket listens on a fake sd_notify socket, returning the states
+// written to it.
+func notifySocket(t *testing.T) <-chan string {
+	dir, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	addr := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	setenv(t, "NOTIFY_SOCKET", addr)
+
+	states := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			select {
+			case states <- string(buf[:n]):
+			default:
+			}
+		}
+	}()
+
+	return states
+}
+
+// await the state, failing the test if it is not written before the timeout.
+func await(t *testing.T, states <-chan string, state string, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case s := <-states:
+			if s == state {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("expected %s to be written to the notify socket", state)
+		}
+	}
+}
+
+// idle is a source that produces no events until it is closed.
+type idle chan alerts.Event
+
+func (t idle) Events() (<-chan alerts.Event, error) {
+	return t, nil
+}
+
+func TestHealthWatchdog(t *testing.T) {
+	const watchdog = 400 * time.Millisecond
+
+	states := notifySocket(t)
+	setenv(t, "WATCHDOG_USEC", "400000")
+	os.Unsetenv("WATCHDOG_PID")
+
+	h := newHealth()
+	if h.watchdog != watchdog {
+		t.Fatalf("expected a %s watchdog, got %s", watchdog, h.watchdog)
+	}
+
+	src := make(idle)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		alerts.Run(src, alerts.AlertObserver(h.observer("system", &systemd.Conn{})))
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.run(ctx)
+
+	await(t, states, "READY=1", time.Second)
+
+	// the watchdog is shorter than the default heartbeat of the loop, it is
+	// only pinged if the loop reports progress within the window.
+	await(t, states, "WATCHDOG=1", time.Second)
+
+	close(src)
+	<-stopped
+
+	// once the loop stops making progress the pings are withheld.
+	time.Sleep(watchdog)
+	for len(states) > 0 {
+		<-states
+	}
+
+	deadline := time.After(watchdog)
+	for {
+		select {
+		case s := <-states:
+			if s == "WATCHDOG=1" {
+				t.Fatal("expected the watchdog ping to be withheld for a stalled loop")
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
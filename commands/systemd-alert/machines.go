@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+// runMachines monitors every container registered with systemd-machined,
+// attaching and detaching as containers start and stop.
+func runMachines(s sourceConfig, a agentConfig, settings *alerts.Settings) {
+	const (
+		backoff = 10 * time.Second
+	)
+
+	for {
+		var (
+			err      error
+			machined *systemd.Machined
+			events   <-chan systemd.MachineEvent
+		)
+
+		if machined, err = systemd.NewMachined(); err != nil {
+			log.Println(errors.Wrapf(err, "source %s: failed to connect to machined", s.Name))
+			time.Sleep(backoff)
+			continue
+		}
+
+		if events, err = machined.Watch(); err != nil {
+			log.Println(errors.Wrapf(err, "source %s: failed to watch machines", s.Name))
+			machined.Close()
+			time.Sleep(backoff)
+			continue
+		}
+
+		running := make(map[string]*attachment)
+		for e := range events {
+			if r, ok := running[e.Name]; ok {
+				r.stop()
+				delete(running, e.Name)
+			}
+
+			if e.Removed || e.Class != "container" {
+				continue
+			}
+
+			m := e.Machine
+			r := newAttachment(m.Name, fmt.Sprintf("/proc/%d/root", m.Leader), func() (*systemd.Conn, error) {
+				return systemd.NewMachineConnection(m)
+			})
+			running[e.Name] = r
+			go r.run(a, settings)
+		}
+
+		for _, r := range running {
+			r.stop()
+		}
+
+		log.Println("source", s.Name, "lost connection to machined")
+		time.Sleep(backoff)
+	}
+}
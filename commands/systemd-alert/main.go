@@ -5,9 +5,11 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"syscall"
 	"time"
 
+	"github.com/james-lawrence/systemd-alert/internal/config"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/forward"
 	"github.com/james-lawrence/systemd-alert/systemd"
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
@@ -15,14 +17,19 @@ import (
 
 func main() {
 	var (
-		pcmd        string
-		err         error
-		uconn, conn *systemd.Conn
-		_, shutdown = context.WithCancel(context.Background())
+		pcmd          string
+		err           error
+		uconn, conn   *systemd.Conn
+		ctx, shutdown = context.WithCancel(context.Background())
+		h             = newHealth()
 	)
 
+	log.SetOutput(config.RedactWriter(os.Stderr))
+
+	// commands that monitor systemd fail without a connection, the rest
+	// (e.g. replay) work without one.
 	if conn, err = systemd.NewSystemConnection(); err != nil {
-		log.Fatalln(errors.Wrap(err, "failed to open systemd connection"))
+		log.Println(errors.Wrap(err, "failed to open systemd connection"))
 	}
 
 	if uconn, err = systemd.NewUserConnection(); err != nil {
@@ -32,18 +39,36 @@ func main() {
 	app := kingpin.New("systemd-alert", "monitoring around systemd")
 
 	cmd := app.Command("slack", "send alerts to slack")
-	(&slackAlert{uconn: uconn, conn: conn}).configure(cmd)
+	(&slackAlert{uconn: uconn, conn: conn, health: h}).configure(cmd)
 	cmd = app.Command("debug", "debug to stderr")
-	(&debugAlert{uconn: uconn, conn: conn}).configure(cmd)
+	(&debugAlert{uconn: uconn, conn: conn, health: h}).configure(cmd)
+	cmd = app.Command("record", "record unit events for later replay")
+	(&record{uconn: uconn, conn: conn}).configure(cmd)
+	cmd = app.Command("replay", "replay recorded events through the configured notifications")
+	(&replay{}).configure(cmd)
+	cmd = app.Command("test", "send a synthetic alert through the configured notifications")
+	(&test{}).configure(cmd)
+	cmd = app.Command("check-config", "validate a configuration file")
+	(&checkConfig{}).configure(cmd)
+	cmd = app.Command("collector", "receive alerts forwarded by agents")
+	(&collector{}).configure(cmd)
 	cmd = app.Command("default", "default uses a configuration file to bootstrap notifications").Default()
-	(&_default{uconn: uconn, conn: conn}).configure(cmd)
+	(&_default{uconn: uconn, conn: conn, health: h}).configure(cmd)
 
 	if pcmd, err = app.Parse(os.Args[1:]); err != nil {
 		log.Fatalln(pcmd, errors.Wrap(err, "failed to parse commandline"))
 	}
 
+	// one shot commands have finished by the time parsing returns.
+	switch pcmd {
+	case "replay", "test", "check-config":
+		return
+	}
+
+	go h.run(ctx)
+
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Kill, os.Interrupt, syscall.SIGUSR2)
+	signal.Notify(signals, os.Kill, os.Interrupt)
 
 	for {
 		select {
@@ -58,17 +83,29 @@ func main() {
 
 done:
 	shutdown()
+
+	if err = systemd.Notify("STOPPING=1"); err != nil {
+		log.Println(err)
+	}
 }
 
+var errUnavailable = errors.New("systemd connection is unavailable")
+
 type agentConfig struct {
 	Frequency time.Duration
 	Ignore    []string
+	Labels    map[string]string
+	Sources   []sourceConfig
+	Silences  []forward.Silence // applied by the collector
+	origins   map[string]origin // where each setting was declared
+	silenced  []origin          // where each silence was declared
 }
 
 func (t *agentConfig) UnmarshalTOML(decode func(interface{}) error) error {
 	type tomlAgent struct {
 		Frequency string
 		Ignore    []string
+		Labels    map[string]string
 	}
 
 	var (
@@ -83,12 +120,12 @@ func (t *agentConfig) UnmarshalTOML(decode func(interface{}) error) error {
 
 	if dec.Frequency != "" {
 		if freq, err = time.ParseDuration(dec.Frequency); err != nil {
-			return errors.Errorf("invalid agent frequency %q: %v", dec.Frequency, err)
+			return notifications.KeyError{Key: "frequency", Err: errors.Errorf("invalid agent frequency %q: %v", dec.Frequency, err)}
 		}
 	}
 
 	// Assign the decoded value.
-	*t = agentConfig{Frequency: freq, Ignore: dec.Ignore}
+	*t = agentConfig{Frequency: freq, Ignore: dec.Ignore, Labels: dec.Labels}
 
 	return nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// record captures every unit and job event to a file for later replay.
+type record struct {
+	conn, uconn *systemd.Conn
+	Output      string
+}
+
+func (t *record) configure(cmd *kingpin.CmdClause) {
+	cmd.Flag("out", "file to write the events to").Required().StringVar(&t.Output)
+	cmd.Action(t.execute)
+}
+
+func (t *record) execute(c *kingpin.ParseContext) error {
+	var (
+		err error
+		dst *os.File
+	)
+
+	if t.conn == nil {
+		return errUnavailable
+	}
+
+	if dst, err = os.OpenFile(t.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return errors.Wrap(err, "failed to open output")
+	}
+
+	sources := []alerts.EventSource{alerts.NewDBusSource(t.conn)}
+	if t.uconn != nil {
+		sources = append(sources, alerts.NewDBusSource(t.uconn))
+	}
+
+	go func() {
+		defer dst.Close()
+		if err := alerts.Record(alerts.Merge(sources...), dst); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// replay pushes recorded events through the configured pipeline.
+type replay struct {
+	Events    string
+	Config    string
+	ConfigDir string
+	Speed     string
+	Instant   bool
+	DryRun    bool
+}
+
+func (t *replay) configure(cmd *kingpin.CmdClause) {
+	cmd.Arg("events", "file containing recorded events").Required().ExistingFileVar(&t.Events)
+	cmd.Flag("config", "path to the file containing the configuration").ExistingFileVar(&t.Config)
+	cmd.Flag("config-dir", "directory of configuration snippets merged into the configuration, defaults to conf.d next to it").StringVar(&t.ConfigDir)
+	cmd.Flag("speed", "replay speed relative to the recording, e.g. 10x").Default("1x").StringVar(&t.Speed)
+	cmd.Flag("instant", "replay events without delay").BoolVar(&t.Instant)
+	cmd.Flag("dry-run", "print what would have been sent instead of sending it").BoolVar(&t.DryRun)
+	cmd.Action(t.execute)
+}
+
+func (t *replay) execute(c *kingpin.ParseContext) error {
+	var (
+		err      error
+		speed    float64
+		a        agentConfig
+		alerters []alerts.Notifier
+		src      *os.File
+	)
+
+	if speed, err = strconv.ParseFloat(strings.TrimSuffix(t.Speed, "x"), 64); err != nil || speed <= 0 {
+		return errors.Errorf("invalid speed %q", t.Speed)
+	}
+
+	if t.Instant {
+		speed = 0
+	}
+
+	if a, alerters, err = decodeConfig(t.Config, t.ConfigDir); err != nil {
+		return err
+	}
+
+	if t.DryRun {
+		alerters = []alerts.Notifier{dryRun{notifiers: alerters}}
+	}
+
+	if src, err = os.Open(t.Events); err != nil {
+		return errors.Wrap(err, "failed to open events")
+	}
+	defer src.Close()
+
+	// batches and cooldowns follow the recorded time of the events, so the
+	// frequency is not scaled by the speed.
+	alerts.Run(alerts.NewReplaySource(src, speed),
+		alerts.AlertNotifiers(alerters...),
+		alerts.AlertFrequency(a.Frequency),
+		alerts.AlertIgnoreServices(a.Ignore...),
+	)
+
+	return nil
+}
+
+// dryRun prints the batches each notifier would have received.
+type dryRun struct {
+	notifiers []alerts.Notifier
+}
+
+func (t dryRun) Alert(units ...*systemd.UnitStatus) {
+	t.print("alert", units...)
+}
+
+func (t dryRun) Resolve(units ...*systemd.UnitStatus) {
+	t.print("resolve", units...)
+}
+
+func (t dryRun) print(action string, units ...*systemd.UnitStatus) {
+	for _, n := range t.notifiers {
+		if _, ok := n.(alerts.Resolver); !ok && action == "resolve" {
+			continue
+		}
+
+		for _, unit := range units {
+			fmt.Printf("%s %T %s %s - %s\n", action, n, unit.Label(), unit.ActiveState, unit.SubState)
+		}
+	}
+}
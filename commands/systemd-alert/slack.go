@@ -13,6 +13,7 @@ type slackAlert struct {
 	Alerter   *slack.Alerter
 	conn      *systemd.Conn
 	uconn     *systemd.Conn
+	health    *health
 	Frequency time.Duration
 	IgnoreSet []string
 }
@@ -29,7 +30,11 @@ func (t *slackAlert) configure(cmd *kingpin.CmdClause) {
 }
 
 func (t *slackAlert) execute(c *kingpin.ParseContext) error {
-	go alerts.Run(t.conn, alerts.AlertNotifiers(t.Alerter), alerts.AlertFrequency(t.Frequency), alerts.AlertIgnoreServices(t.IgnoreSet...))
-	go alerts.SafeRun(t.uconn, alerts.AlertNotifiers(t.Alerter), alerts.AlertFrequency(t.Frequency), alerts.AlertIgnoreServices(t.IgnoreSet...))
+	if t.conn == nil {
+		return errUnavailable
+	}
+
+	go alerts.Run(alerts.NewDBusSource(t.conn), alerts.AlertNotifiers(t.Alerter), alerts.AlertFrequency(t.Frequency), alerts.AlertIgnoreServices(t.IgnoreSet...), alerts.AlertObserver(t.health.observer("system", t.conn)))
+	go alerts.SafeRun(t.uconn, alerts.AlertNotifiers(t.Alerter), alerts.AlertFrequency(t.Frequency), alerts.AlertIgnoreServices(t.IgnoreSet...), alerts.AlertObserver(t.health.observer("user", t.uconn)))
 	return nil
 }
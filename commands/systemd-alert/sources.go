@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+// sourceConfig describes an additional systemd instance to monitor, typically
+// on a remote host.
+type sourceConfig struct {
+	Name    string
+	Type    string   // bus (default), machined or logind
+	Address string   // bus address to dial, e.g. tcp:host=example.com,port=5555
+	Command []string // command speaking D-Bus on stdio, e.g. ["ssh", "host", "systemd-stdio-bridge"]
+}
+
+// run the alert loops for the source.
+func (t sourceConfig) run(a agentConfig, settings *alerts.Settings) {
+	switch t.Type {
+	case "machined":
+		runMachines(t, a, settings)
+	case "logind":
+		runUsers(t, a, settings)
+	default:
+		runSource(t, a, settings)
+	}
+}
+
+func (t sourceConfig) dial() (*systemd.Conn, error) {
+	switch {
+	case len(t.Command) > 0:
+		return systemd.NewCommandConnection(t.Command...)
+	case t.Address != "":
+		return systemd.NewAddressConnection(t.Address)
+	default:
+		return nil, errors.Errorf("source %s: an address or command is required", t.Name)
+	}
+}
+
+// runSource runs the alert loop for the source, reconnecting whenever the
+// connection is lost.
+func runSource(s sourceConfig, a agentConfig, settings *alerts.Settings) {
+	const (
+		backoff = 10 * time.Second
+	)
+
+	for {
+		conn, err := s.dial()
+		if err != nil {
+			log.Println(errors.Wrapf(err, "failed to connect to source %s", s.Name))
+			time.Sleep(backoff)
+			continue
+		}
+
+		alerts.Run(alerts.NewDBusSource(conn, alerts.SourceName(s.Name), alerts.SourceLabels(a.Labels)),
+			alerts.AlertSettings(settings),
+			alerts.AlertFrequency(a.Frequency),
+		)
+
+		conn.Close()
+		log.Println("lost connection to source", s.Name)
+		time.Sleep(backoff)
+	}
+}
+
+func newAttachment(name, root string, dial func() (*systemd.Conn, error)) *attachment {
+	return &attachment{
+		m:    &sync.Mutex{},
+		name: name,
+		root: root,
+		dial: dial,
+		done: make(chan struct{}),
+	}
+}
+
+// attachment runs the alert loop for a dynamically discovered systemd
+// instance until stopped, labeling alerts with its name.
+type attachment struct {
+	m    *sync.Mutex
+	name string
+	root string // the instance's root filesystem, used to read its unit files
+	dial func() (*systemd.Conn, error)
+	conn *systemd.Conn
+	done chan struct{}
+}
+
+func (t *attachment) stop() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	close(t.done)
+	if t.conn != nil {
+		t.conn.Close()
+	}
+}
+
+// attach sets the active connection, returning false if the attachment was stopped.
+func (t *attachment) attach(conn *systemd.Conn) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	select {
+	case <-t.done:
+		return false
+	default:
+		t.conn = conn
+		return true
+	}
+}
+
+func (t *attachment) run(a agentConfig, settings *alerts.Settings) {
+	const (
+		backoff = 5 * time.Second
+	)
+
+	for {
+		// the systemd instance may not be listening yet when it is
+		// discovered, so keep retrying until stopped.
+		conn, err := t.dial()
+		if err != nil {
+			log.Println(errors.Wrapf(err, "failed to attach to %s", t.name))
+		} else if !t.attach(conn) {
+			conn.Close()
+			return
+		} else {
+			log.Println("attached to", t.name)
+			alerts.Run(alerts.NewDBusSource(conn, alerts.SourceName(t.name), alerts.SourceLabels(a.Labels), alerts.SourceUnitFiles(t.root)),
+				alerts.AlertSettings(settings),
+				alerts.AlertFrequency(a.Frequency),
+			)
+			conn.Close()
+			log.Println("detached from", t.name)
+		}
+
+		select {
+		case <-t.done:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
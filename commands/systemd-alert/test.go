@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/config"
+	"github.com/james-lawrence/systemd-alert/notifications/forward"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// test delivers a synthetic batch through the configured notifications.
+type test struct {
+	Config      string
+	ConfigDir   string
+	Notifiers   []string
+	Unit        string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Source      string
+	Labels      map[string]string
+	Resolve     bool
+}
+
+func (t *test) configure(cmd *kingpin.CmdClause) {
+	cmd.Flag("config", "path to the file containing the configuration").ExistingFileVar(&t.Config)
+	cmd.Flag("config-dir", "directory of configuration snippets merged into the configuration, defaults to conf.d next to it").StringVar(&t.ConfigDir)
+	cmd.Flag("notifier", "only deliver to notifiers of this type, repeatable").StringsVar(&t.Notifiers)
+	cmd.Flag("unit", "name of the synthetic unit").Default("systemd-alert-test.service").StringVar(&t.Unit)
+	cmd.Flag("load-state", "load state of the synthetic unit").Default("loaded").StringVar(&t.LoadState)
+	cmd.Flag("active-state", "active state of the synthetic unit").Default("failed").StringVar(&t.ActiveState)
+	cmd.Flag("sub-state", "sub state of the synthetic unit").Default("failed").StringVar(&t.SubState)
+	cmd.Flag("source", "source the synthetic unit was observed on").StringVar(&t.Source)
+	cmd.Flag("label", "additional host label, e.g. env=prod").StringMapVar(&t.Labels)
+	cmd.Flag("resolve", "also resolve the unit after alerting").BoolVar(&t.Resolve)
+	cmd.Action(t.execute)
+}
+
+func (t *test) execute(c *kingpin.ParseContext) error {
+	var (
+		err     error
+		a       agentConfig
+		plugins []plugin
+		failed  int
+	)
+
+	if a, plugins, err = loadConfig(t.Config, t.ConfigDir); err != nil {
+		return err
+	}
+
+	if plugins = t.selected(plugins); len(plugins) == 0 {
+		return errors.Errorf("no configured notifiers match %v", t.Notifiers)
+	}
+
+	host := systemd.LocalHost()
+	host.Labels = make(map[string]string, len(a.Labels)+len(t.Labels))
+	for k, v := range a.Labels {
+		host.Labels[k] = v
+	}
+	for k, v := range t.Labels {
+		host.Labels[k] = v
+	}
+
+	unit := &systemd.UnitStatus{
+		Name:        t.Unit,
+		LoadState:   t.LoadState,
+		ActiveState: t.ActiveState,
+		SubState:    t.SubState,
+		Source:      t.Source,
+		Host:        &host,
+	}
+
+	for _, p := range plugins {
+		// forwarders send directly instead of replaying the agent's spool.
+		if _, ok := p.Notifier.(*forward.Alerter); !ok {
+			if s, ok := p.Notifier.(alerts.Starter); ok {
+				s.Start()
+			}
+		}
+
+		if err = deliver(p, unit); err != nil {
+			failed++
+		}
+		report(p, "alert", err)
+
+		if !t.Resolve {
+			continue
+		}
+
+		if _, ok := p.Notifier.(alerts.Resolver); !ok {
+			continue
+		}
+
+		if err = resolve(p, unit); err != nil {
+			failed++
+		}
+		report(p, "resolve", err)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d notifiers failed", failed, len(plugins))
+	}
+
+	return nil
+}
+
+func (t *test) selected(plugins []plugin) []plugin {
+	if len(t.Notifiers) == 0 {
+		return plugins
+	}
+
+	filtered := make([]plugin, 0, len(plugins))
+	for _, p := range plugins {
+		for _, name := range t.Notifiers {
+			if p.Name == name {
+				filtered = append(filtered, p)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// deliver the unit, notifiers that cannot report delivery are assumed to
+// have succeeded. forwarders deliver without spooling.
+func deliver(p plugin, unit *systemd.UnitStatus) error {
+	if d, ok := p.Notifier.(alerts.Deliverer); ok {
+		return d.Deliver(unit)
+	}
+
+	p.Alert(unit)
+	return nil
+}
+
+func resolve(p plugin, unit *systemd.UnitStatus) error {
+	if d, ok := p.Notifier.(alerts.ResolveDeliverer); ok {
+		return d.DeliverResolve(unit)
+	}
+
+	p.Notifier.(alerts.Resolver).Resolve(unit)
+	return nil
+}
+
+func report(p plugin, action string, err error) {
+	location := p.Name
+	if p.File != "" {
+		location = fmt.Sprintf("%s (%s)", p.Name, p.origin)
+	}
+
+	if err != nil {
+		fmt.Printf("%s %s: %s\n", action, location, config.Redact(err.Error()))
+		return
+	}
+
+	fmt.Printf("%s %s: ok\n", action, location)
+}
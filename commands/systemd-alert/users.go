@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+// runUsers monitors the systemd --user instance of every user known to
+// systemd-logind, attaching and detaching as users log in and out.
+// requires the agent to run as root.
+func runUsers(s sourceConfig, a agentConfig, settings *alerts.Settings) {
+	const (
+		backoff = 10 * time.Second
+	)
+
+	for {
+		var (
+			err    error
+			logind *systemd.Logind
+			events <-chan systemd.UserEvent
+		)
+
+		if logind, err = systemd.NewLogind(); err != nil {
+			log.Println(errors.Wrapf(err, "source %s: failed to connect to logind", s.Name))
+			time.Sleep(backoff)
+			continue
+		}
+
+		if events, err = logind.Watch(); err != nil {
+			log.Println(errors.Wrapf(err, "source %s: failed to watch users", s.Name))
+			logind.Close()
+			time.Sleep(backoff)
+			continue
+		}
+
+		running := make(map[uint32]*attachment)
+		for e := range events {
+			if r, ok := running[e.UID]; ok {
+				r.stop()
+				delete(running, e.UID)
+			}
+
+			if e.Removed {
+				continue
+			}
+
+			u := e.User
+			r := newAttachment(u.Name, "/", func() (*systemd.Conn, error) {
+				return systemd.NewUserManagerConnection(u)
+			})
+			running[e.UID] = r
+			go r.run(a, settings)
+		}
+
+		for _, r := range running {
+			r.stop()
+		}
+
+		log.Println("source", s.Name, "lost connection to logind")
+		time.Sleep(backoff)
+	}
+}
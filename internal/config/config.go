@@ -3,27 +3,67 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/naoina/toml"
 	"github.com/naoina/toml/ast"
+	"github.com/pkg/errors"
 )
 
-func Decode(path string) *ast.Table {
+// Decode parses the configuration file, expanding environment variables in
+// string values.
+func Decode(path string) (table *ast.Table, err error) {
 	var (
-		err   error
-		raw   []byte
-		table *ast.Table
+		raw []byte
 	)
 
 	if raw, err = ioutil.ReadFile(path); err != nil {
-		panic(err)
+		return nil, errors.Wrap(err, "failed to read configuration")
 	}
 
-	raw = []byte(os.ExpandEnv(string(raw)))
-
 	if table, err = toml.Parse(raw); err != nil {
-		panic(err)
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
 	}
 
-	return table
+	ExpandEnv(table)
+
+	return table, nil
+}
+
+// ExpandEnv expands environment variables in the string values of the table.
+// templates are left as written since their variables, e.g. {{ $u.Label }},
+// share the syntax of environment variables.
+func ExpandEnv(tbl *ast.Table) {
+	for _, v := range tbl.Fields {
+		expand(v)
+	}
+}
+
+func expand(v interface{}) {
+	switch v := v.(type) {
+	case *ast.Table:
+		ExpandEnv(v)
+	case []*ast.Table:
+		for _, t := range v {
+			ExpandEnv(t)
+		}
+	case *ast.KeyValue:
+		expandValue(v.Value)
+	}
+}
+
+func expandValue(v ast.Value) {
+	switch v := v.(type) {
+	case *ast.String:
+		if !strings.Contains(v.Value, "{{") {
+			v.Value = os.ExpandEnv(v.Value)
+		}
+	case *ast.Array:
+		for _, e := range v.Value {
+			expandValue(e)
+		}
+	case *ast.Table:
+		// inline table.
+		ExpandEnv(v)
+	}
 }
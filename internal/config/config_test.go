@@ -0,0 +1,58 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naoina/toml/ast"
+)
+
+func TestDecodeExpandsEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("SYSTEMD_ALERT_TEST_USER", "agent")
+	defer os.Unsetenv("SYSTEMD_ALERT_TEST_USER")
+
+	path := filepath.Join(dir, "config.toml")
+	if err = ioutil.WriteFile(path, []byte(`[agent]
+ignore = ["${SYSTEMD_ALERT_TEST_USER}.service"]
+
+[[notifications.webhook]]
+url = "https://$SYSTEMD_ALERT_TEST_USER.example.com"
+headers = { X-User = "$SYSTEMD_ALERT_TEST_USER" }
+body = '{{ range $i, $u := .Units }}{{ $u.Label }}{{ end }}'
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, err := Decode(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := tbl.Fields["agent"].(*ast.Table)
+	if v := agent.Fields["ignore"].(*ast.KeyValue).Value.(*ast.Array).Value[0].(*ast.String).Value; v != "agent.service" {
+		t.Errorf("expected the ignore pattern to be expanded, got %q", v)
+	}
+
+	webhook := tbl.Fields["notifications"].(*ast.Table).Fields["webhook"].([]*ast.Table)[0]
+	for key, expected := range map[string]string{
+		"url":  "https://agent.example.com",
+		"body": "{{ range $i, $u := .Units }}{{ $u.Label }}{{ end }}",
+	} {
+		if v := webhook.Fields[key].(*ast.KeyValue).Value.(*ast.String).Value; v != expected {
+			t.Errorf("expected %s to be %q, got %q", key, expected, v)
+		}
+	}
+
+	headers := webhook.Fields["headers"].(*ast.Table)
+	if v := headers.Fields["X-User"].(*ast.KeyValue).Value.(*ast.String).Value; v != "agent" {
+		t.Errorf("expected the inline table to be expanded, got %q", v)
+	}
+}
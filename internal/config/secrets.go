@@ -0,0 +1,171 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/naoina/toml"
+	"github.com/naoina/toml/ast"
+	"github.com/pkg/errors"
+)
+
+const redacted = "[redacted]"
+
+// secrets shorter than this are not redacted, replacing every occurrence of
+// e.g. "1" or "x" would mangle the output without protecting anything.
+const minRedacted = 6
+
+var (
+	secretsm = &sync.RWMutex{}
+	secrets  = map[string]bool{}
+)
+
+// ResolveSecrets replaces secret references in the string values of the
+// table with the secret they refer to:
+//   - file:/path reads the file.
+//   - env:NAME reads the environment variable.
+//   - credential:name reads the systemd credential from $CREDENTIALS_DIRECTORY,
+//     see LoadCredential= in systemd.exec(5).
+//
+// resolved secrets are redacted by Redact.
+func ResolveSecrets(tbl *ast.Table) error {
+	for _, v := range tbl.Fields {
+		if err := resolve(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolve(v interface{}) (err error) {
+	switch v := v.(type) {
+	case *ast.Table:
+		return ResolveSecrets(v)
+	case []*ast.Table:
+		for _, t := range v {
+			if err = ResolveSecrets(t); err != nil {
+				return err
+			}
+		}
+	case *ast.KeyValue:
+		if err = resolveValue(v.Value); err != nil {
+			return &toml.LineError{Line: v.Line, Err: errors.Wrap(err, v.Key)}
+		}
+	}
+
+	return nil
+}
+
+func resolveValue(v ast.Value) (err error) {
+	switch v := v.(type) {
+	case *ast.String:
+		v.Value, err = Secret(v.Value)
+		return err
+	case *ast.Array:
+		for _, e := range v.Value {
+			if err = resolveValue(e); err != nil {
+				return err
+			}
+		}
+	case *ast.Table:
+		// inline table.
+		return ResolveSecrets(v)
+	}
+
+	return nil
+}
+
+// Secret resolves the value if it is a secret reference, otherwise it is
+// returned as is.
+func Secret(value string) (secret string, err error) {
+	var (
+		raw []byte
+	)
+
+	switch {
+	case strings.HasPrefix(value, "file:"):
+		if raw, err = ioutil.ReadFile(strings.TrimPrefix(value, "file:")); err != nil {
+			return "", errors.Wrap(err, "failed to read secret")
+		}
+		secret = strings.TrimRight(string(raw), "\r\n")
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		ok := false
+		if secret, ok = os.LookupEnv(name); !ok {
+			return "", errors.Errorf("secret environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(value, "credential:"):
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return "", errors.New("secret credentials are unavailable, $CREDENTIALS_DIRECTORY is not set")
+		}
+
+		name := strings.TrimPrefix(value, "credential:")
+		if strings.ContainsRune(name, '/') {
+			return "", errors.Errorf("invalid credential name %q", name)
+		}
+
+		if raw, err = ioutil.ReadFile(filepath.Join(dir, name)); err != nil {
+			return "", errors.Wrap(err, "failed to read credential")
+		}
+		secret = strings.TrimRight(string(raw), "\r\n")
+	default:
+		return value, nil
+	}
+
+	if len(strings.TrimSpace(secret)) >= minRedacted {
+		secretsm.Lock()
+		secrets[secret] = true
+		secretsm.Unlock()
+	}
+
+	return secret, nil
+}
+
+// Redact replaces every resolved secret in the string.
+func Redact(s string) string {
+	secretsm.RLock()
+	defer secretsm.RUnlock()
+
+	if len(secrets) == 0 {
+		return s
+	}
+
+	// replace longer secrets first so a secret containing another is
+	// redacted entirely.
+	known := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		known = append(known, secret)
+	}
+	sort.Slice(known, func(i, j int) bool { return len(known[i]) > len(known[j]) })
+
+	for _, secret := range known {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+
+	return s
+}
+
+// RedactWriter redacts resolved secrets from everything written to w, e.g.
+// log.SetOutput(config.RedactWriter(os.Stderr)).
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w: w}
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (t redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(t.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
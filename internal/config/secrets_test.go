@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naoina/toml"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "webhook"), []byte("https://hooks.example.com/file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "token"), []byte("credential-secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("SYSTEMD_ALERT_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("SYSTEMD_ALERT_TEST_SECRET")
+	os.Setenv("CREDENTIALS_DIRECTORY", dir)
+	defer os.Unsetenv("CREDENTIALS_DIRECTORY")
+
+	tbl, err := toml.Parse([]byte(`
+webhook = "file:` + filepath.Join(dir, "webhook") + `"
+password = "env:SYSTEMD_ALERT_TEST_SECRET"
+token = "credential:token"
+channel = "#ops"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ResolveSecrets(tbl); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Webhook  string
+		Password string
+		Token    string
+		Channel  string
+	}
+
+	if err = toml.UnmarshalTable(tbl, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Webhook != "https://hooks.example.com/file-secret" || decoded.Password != "env-secret" || decoded.Token != "credential-secret" || decoded.Channel != "#ops" {
+		t.Fatalf("unexpected resolved values %+v", decoded)
+	}
+
+	var buf bytes.Buffer
+	RedactWriter(&buf).Write([]byte("failed to post https://hooks.example.com/file-secret with env-secret to #ops"))
+	if expected := "failed to post [redacted] with [redacted] to #ops"; buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestRedactSkipsShortSecrets(t *testing.T) {
+	os.Setenv("SYSTEMD_ALERT_TEST_SHORT", "x")
+	defer os.Unsetenv("SYSTEMD_ALERT_TEST_SHORT")
+	os.Setenv("SYSTEMD_ALERT_TEST_EMPTY", "")
+	defer os.Unsetenv("SYSTEMD_ALERT_TEST_EMPTY")
+
+	for _, ref := range []string{"env:SYSTEMD_ALERT_TEST_SHORT", "env:SYSTEMD_ALERT_TEST_EMPTY"} {
+		if _, err := Secret(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s := "exit-code on web1.example.com"; Redact(s) != s {
+		t.Fatalf("expected short secrets to be left in %q, got %q", s, Redact(s))
+	}
+}
+
+func TestResolveSecretsMissing(t *testing.T) {
+	os.Unsetenv("CREDENTIALS_DIRECTORY")
+
+	for _, ref := range []string{"env:SYSTEMD_ALERT_TEST_MISSING", "credential:token", "file:/nonexistent/secret"} {
+		tbl, err := toml.Parse([]byte(`webhook = "` + ref + `"`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = ResolveSecrets(tbl); err == nil {
+			t.Errorf("expected %s to fail", ref)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package notifytest provides the fixtures shared by the tests of notifiers
+// that deliver over HTTP.
+package notifytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/naoina/toml"
+)
+
+// Request - a request received by the fake server.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Decode the json body of the request, it is safe to call from handlers.
+func (t Request) Decode(tb testing.TB, v interface{}) {
+	if err := json.Unmarshal(t.Body, v); err != nil {
+		tb.Errorf("invalid request body %q: %v", t.Body, err)
+	}
+}
+
+// Response - written by the fake server.
+type Response struct {
+	Status int
+	Header map[string]string
+	Body   string
+}
+
+// Serve records every request, responding with the statuses in order. the
+// last status is repeated once they are exhausted.
+func Serve(t *testing.T, statuses ...int) (*httptest.Server, <-chan Request) {
+	return Handle(t, func(n int, r Request) Response {
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+
+		return Response{Status: statuses[n]}
+	})
+}
+
+// Handle records every request, responding with the response returned by
+// respond. n counts the requests received, starting at 0.
+func Handle(t *testing.T, respond func(n int, r Request) Response) (*httptest.Server, <-chan Request) {
+	var (
+		m        sync.Mutex
+		received int
+	)
+
+	requests := make(chan Request, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		req := Request{Method: r.Method, URL: r.URL, Header: r.Header, Body: body}
+
+		m.Lock()
+		n := received
+		received++
+		m.Unlock()
+
+		resp := respond(n, req)
+		requests <- req
+
+		for k, v := range resp.Header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(resp.Status)
+		fmt.Fprint(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, requests
+}
+
+// Decode the configuration into the notifier, validating it when the
+// notifier can check its configuration.
+func Decode(t *testing.T, n alerts.Notifier, config string) {
+	tbl, err := toml.Parse([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = toml.UnmarshalTable(tbl, n); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := n.(notifications.Validator); ok {
+		if err = v.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
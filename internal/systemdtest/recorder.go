@@ -0,0 +1,42 @@
+package systemdtest
+
+import (
+	"time"
+
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// NewRecorder creates a notifier that records every batch it receives.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		Alerts:   make(chan []*systemd.UnitStatus, 100),
+		Resolved: make(chan []*systemd.UnitStatus, 100),
+	}
+}
+
+// Recorder - notifier that records alerted and resolved batches.
+type Recorder struct {
+	Alerts   chan []*systemd.UnitStatus
+	Resolved chan []*systemd.UnitStatus
+}
+
+// Alert records the batch.
+func (t *Recorder) Alert(units ...*systemd.UnitStatus) {
+	t.Alerts <- units
+}
+
+// Resolve records the batch.
+func (t *Recorder) Resolve(units ...*systemd.UnitStatus) {
+	t.Resolved <- units
+}
+
+// Next waits up to the timeout for the next batch on the channel, returning
+// nil if none arrives.
+func Next(batches <-chan []*systemd.UnitStatus, timeout time.Duration) []*systemd.UnitStatus {
+	select {
+	case units := <-batches:
+		return units
+	case <-time.After(timeout):
+		return nil
+	}
+}
@@ -0,0 +1,492 @@
+// Package systemdtest provides an in-process fake of systemd's D-Bus API for
+// tests. Connections are peer-to-peer, the same way the agent talks to
+// /run/systemd/private, so no bus daemon is required.
+package systemdtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/godbus/dbus"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MachineID reported by the fake manager.
+	MachineID = "0123456789abcdef0123456789abcdef"
+	// Hostname reported by the fake hostnamed.
+	Hostname = "systemdtest"
+
+	managerPath   = dbus.ObjectPath("/org/freedesktop/systemd1")
+	hostnamedPath = dbus.ObjectPath("/org/freedesktop/hostname1")
+)
+
+// Unit is a unit exported by the fake manager.
+type Unit struct {
+	Name        string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Result      string
+	NRestarts   uint32
+	Path        dbus.ObjectPath
+	Fragment    string
+	DropIns     []string
+}
+
+// NewServer creates a fake systemd manager without any units.
+func NewServer() *Server {
+	return &Server{
+		m:     &sync.Mutex{},
+		units: make(map[string]*Unit),
+	}
+}
+
+// Server - fake systemd manager. Every connection dialed from the server
+// receives the signals it emits.
+type Server struct {
+	m     *sync.Mutex
+	conns []*dbus.Conn
+	units map[string]*Unit
+	subs  int
+}
+
+// Connection establishes a *systemd.Conn to the fake manager.
+func (t *Server) Connection() (*systemd.Conn, error) {
+	return systemd.NewConnection(t.Dial)
+}
+
+// Dial establishes an authenticated peer-to-peer connection to the server.
+func (t *Server) Dial() (*dbus.Conn, error) {
+	var (
+		err    error
+		client *dbus.Conn
+	)
+
+	local, remote := net.Pipe()
+	served := make(chan error, 1)
+
+	go func() {
+		served <- t.serve(remote)
+	}()
+
+	if client, err = dbus.NewConn(local); err != nil {
+		return nil, err
+	}
+
+	if err = client.Auth([]dbus.Auth{dbus.AuthExternal(strconv.Itoa(os.Getuid()))}); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if err = <-served; err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Close every connection to the server.
+func (t *Server) Close() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, conn := range t.conns {
+		conn.Close()
+	}
+	t.conns = nil
+}
+
+// Subscribers returns the number of calls to Subscribe the server has received.
+func (t *Server) Subscribers() int {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.subs
+}
+
+// AddUnit exports a loaded unit in the given state and emits UnitNew.
+func (t *Server) AddUnit(name, active, sub string) *Unit {
+	u := &Unit{
+		Name:        name,
+		LoadState:   "loaded",
+		ActiveState: active,
+		SubState:    sub,
+		Path:        dbus.ObjectPath("/org/freedesktop/systemd1/unit/" + systemd.PathBusEscape(name)),
+	}
+
+	t.m.Lock()
+	t.units[name] = u
+	t.m.Unlock()
+
+	t.emit(managerPath, "org.freedesktop.systemd1.Manager.UnitNew", u.Name, u.Path)
+
+	return u
+}
+
+// RemoveUnit removes the unit and emits UnitRemoved.
+func (t *Server) RemoveUnit(name string) {
+	t.m.Lock()
+	u, ok := t.units[name]
+	delete(t.units, name)
+	t.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	t.emit(managerPath, "org.freedesktop.systemd1.Manager.UnitRemoved", u.Name, u.Path)
+}
+
+// SetState changes the state of the unit and emits PropertiesChanged.
+func (t *Server) SetState(name, active, sub string) {
+	t.m.Lock()
+	u, ok := t.units[name]
+	if ok {
+		u.ActiveState = active
+		u.SubState = sub
+	}
+	t.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	t.emit(u.Path, "org.freedesktop.DBus.Properties.PropertiesChanged", "org.freedesktop.systemd1.Unit", unitChanges(active, sub), []string{})
+}
+
+// SetResult sets the result and restart count reported for the service, they
+// are reported with the next state change.
+func (t *Server) SetResult(name, result string, restarts uint32) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if u, ok := t.units[name]; ok {
+		u.Result = result
+		u.NRestarts = restarts
+	}
+}
+
+// SetUnitFiles sets the fragment and drop-in paths reported for the unit.
+func (t *Server) SetUnitFiles(name, fragment string, dropins ...string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if u, ok := t.units[name]; ok {
+		u.Fragment = fragment
+		u.DropIns = dropins
+	}
+}
+
+// UnitFilesChanged emits the UnitFilesChanged signal.
+func (t *Server) UnitFilesChanged() {
+	t.emit(managerPath, "org.freedesktop.systemd1.Manager.UnitFilesChanged")
+}
+
+// JobRemoved emits the JobRemoved signal for a job on the unit.
+func (t *Server) JobRemoved(id uint32, name, result string) {
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/systemd1/job/%d", id))
+	t.emit(managerPath, "org.freedesktop.systemd1.Manager.JobRemoved", id, path, name, result)
+}
+
+func (t *Server) emit(path dbus.ObjectPath, name string, values ...interface{}) {
+	t.m.Lock()
+	conns := append([]*dbus.Conn(nil), t.conns...)
+	t.m.Unlock()
+
+	for _, conn := range conns {
+		conn.Emit(path, name, values...)
+	}
+}
+
+func (t *Server) unit(path dbus.ObjectPath) (Unit, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, u := range t.units {
+		if u.Path == path {
+			return *u, true
+		}
+	}
+
+	return Unit{}, false
+}
+
+// serve answers the client's authentication and exports the fake manager on
+// the server side of the connection.
+func (t *Server) serve(rwc io.ReadWriteCloser) (err error) {
+	var (
+		conn *dbus.Conn
+	)
+
+	if err = handshake(rwc); err != nil {
+		rwc.Close()
+		return err
+	}
+
+	// godbus only processes messages once a connection has authenticated, so
+	// replay the responses of a successful authentication to the server side.
+	replies := bytes.NewBufferString("REJECTED EXTERNAL\r\nOK " + MachineID + "\r\n")
+	if conn, err = dbus.NewConn(scripted{ReadWriteCloser: rwc, replies: replies, begun: new(bool)}); err != nil {
+		rwc.Close()
+		return err
+	}
+
+	if err = conn.Auth([]dbus.Auth{dbus.AuthExternal("0")}); err != nil {
+		conn.Close()
+		return err
+	}
+
+	exports := []struct {
+		v     interface{}
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{v: bus{}, path: "/org/freedesktop/DBus", iface: "org.freedesktop.DBus"},
+		{v: manager{server: t}, path: managerPath, iface: "org.freedesktop.systemd1.Manager"},
+		{v: hostnamed{}, path: hostnamedPath, iface: "org.freedesktop.DBus.Properties"},
+	}
+
+	for _, e := range exports {
+		if err = conn.Export(e.v, e.path, e.iface); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	if err = conn.ExportSubtree(properties{server: t}, "/org/freedesktop/systemd1/unit", "org.freedesktop.DBus.Properties"); err != nil {
+		conn.Close()
+		return err
+	}
+
+	t.m.Lock()
+	t.conns = append(t.conns, conn)
+	t.m.Unlock()
+
+	return nil
+}
+
+// handshake performs the server side of the SASL exchange, accepting
+// EXTERNAL for any user.
+func handshake(rw io.ReadWriter) error {
+	var (
+		err  error
+		line string
+		null = make([]byte, 1)
+	)
+
+	if _, err = io.ReadFull(rw, null); err != nil {
+		return errors.Wrap(err, "failed to read null byte")
+	}
+
+	for {
+		if line, err = readLine(rw); err != nil {
+			return err
+		}
+
+		switch {
+		case line == "AUTH":
+			_, err = io.WriteString(rw, "REJECTED EXTERNAL\r\n")
+		case bytes.HasPrefix([]byte(line), []byte("AUTH EXTERNAL")):
+			_, err = io.WriteString(rw, "OK "+MachineID+"\r\n")
+		case line == "BEGIN":
+			return nil
+		default:
+			_, err = io.WriteString(rw, "ERROR\r\n")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLine reads a single line a byte at a time so no data following the
+// handshake is consumed.
+func readLine(r io.Reader) (string, error) {
+	var (
+		line []byte
+		b    = make([]byte, 1)
+	)
+
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", errors.Wrap(err, "failed to read handshake")
+		}
+
+		if b[0] == '\n' {
+			return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+		}
+
+		line = append(line, b[0])
+	}
+}
+
+// scripted discards writes and serves reads from replies until the
+// authentication completes, after which it passes through.
+type scripted struct {
+	io.ReadWriteCloser
+	replies *bytes.Buffer
+	begun   *bool
+}
+
+func (t scripted) Read(p []byte) (int, error) {
+	if t.replies.Len() > 0 {
+		return t.replies.Read(p)
+	}
+
+	return t.ReadWriteCloser.Read(p)
+}
+
+func (t scripted) Write(p []byte) (int, error) {
+	// the authentication is terminated by BEGIN, everything written after
+	// it is a message.
+	if !*t.begun {
+		*t.begun = bytes.Equal(p, []byte("BEGIN\r\n"))
+		return len(p), nil
+	}
+
+	return t.ReadWriteCloser.Write(p)
+}
+
+type bus struct{}
+
+func (bus) AddMatch(rule string) *dbus.Error {
+	return nil
+}
+
+func (bus) RemoveMatch(rule string) *dbus.Error {
+	return nil
+}
+
+type manager struct {
+	server *Server
+}
+
+func (t manager) Subscribe() *dbus.Error {
+	t.server.m.Lock()
+	defer t.server.m.Unlock()
+	t.server.subs++
+	return nil
+}
+
+func (t manager) Unsubscribe() *dbus.Error {
+	return nil
+}
+
+func (t manager) ListUnits() ([]listing, *dbus.Error) {
+	t.server.m.Lock()
+	defer t.server.m.Unlock()
+
+	units := make([]listing, 0, len(t.server.units))
+	for _, u := range t.server.units {
+		units = append(units, listing{
+			Name:        u.Name,
+			LoadState:   u.LoadState,
+			ActiveState: u.ActiveState,
+			SubState:    u.SubState,
+			Path:        u.Path,
+			JobPath:     dbus.ObjectPath("/"),
+		})
+	}
+
+	return units, nil
+}
+
+// listing matches the signature of ListUnits, a(ssssssouso).
+type listing struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Followed    string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+type properties struct {
+	server *Server
+}
+
+func (t properties) Get(msg dbus.Message, iface, name string) (dbus.Variant, *dbus.Error) {
+	all, err := t.GetAll(msg, iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+
+	v, ok := all[name]
+	if !ok {
+		return dbus.Variant{}, dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []interface{}{name})
+	}
+
+	return v, nil
+}
+
+func (t properties) GetAll(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+	path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	u, ok := t.server.unit(path)
+	if !ok {
+		return nil, dbus.NewError("org.freedesktop.DBus.Error.UnknownObject", []interface{}{string(path)})
+	}
+
+	switch iface {
+	case "org.freedesktop.systemd1.Unit":
+	case "org.freedesktop.systemd1.Service":
+		return map[string]dbus.Variant{
+			"Result":    dbus.MakeVariant(u.Result),
+			"NRestarts": dbus.MakeVariant(u.NRestarts),
+		}, nil
+	default:
+		return map[string]dbus.Variant{}, nil
+	}
+
+	all := unitChanges(u.ActiveState, u.SubState)
+	all["Id"] = dbus.MakeVariant(u.Name)
+	all["LoadState"] = dbus.MakeVariant(u.LoadState)
+	all["FragmentPath"] = dbus.MakeVariant(u.Fragment)
+	all["DropInPaths"] = dbus.MakeVariant(append([]string{}, u.DropIns...))
+	return all, nil
+}
+
+type hostnamed struct{}
+
+func (hostnamed) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	if iface == "org.freedesktop.hostname1" && name == "Hostname" {
+		return dbus.MakeVariant(Hostname), nil
+	}
+
+	return dbus.Variant{}, dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []interface{}{name})
+}
+
+// unitChanges is the set of properties systemd reports when a unit changes state.
+func unitChanges(active, sub string) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"ActiveState":                     dbus.MakeVariant(active),
+		"SubState":                        dbus.MakeVariant(sub),
+		"AssertTimestamp":                 dbus.MakeVariant(uint64(0)),
+		"StateChangeTimestamp":            dbus.MakeVariant(uint64(0)),
+		"ActiveEnterTimestampMonotonic":   dbus.MakeVariant(uint64(0)),
+		"ActiveExitTimestamp":             dbus.MakeVariant(uint64(0)),
+		"ActiveExitTimestampMonotonic":    dbus.MakeVariant(uint64(0)),
+		"InactiveExitTimestampMonotonic":  dbus.MakeVariant(uint64(0)),
+		"ActiveEnterTimestamp":            dbus.MakeVariant(uint64(0)),
+		"ConditionResult":                 dbus.MakeVariant(true),
+		"ConditionTimestamp":              dbus.MakeVariant(uint64(0)),
+		"StateChangeTimestampMonotonic":   dbus.MakeVariant(uint64(0)),
+		"InactiveEnterTimestamp":          dbus.MakeVariant(uint64(0)),
+		"InactiveEnterTimestampMonotonic": dbus.MakeVariant(uint64(0)),
+		"ConditionTimestampMonotonic":     dbus.MakeVariant(uint64(0)),
+		"AssertTimestampMonotonic":        dbus.MakeVariant(uint64(0)),
+		"InactiveExitTimestamp":           dbus.MakeVariant(uint64(0)),
+		"AssertResult":                    dbus.MakeVariant(true),
+	}
+}
@@ -28,3 +28,9 @@ func (t Alerter) Alert(units ...*systemd.UnitStatus) {
 		log.Println("alert", unit)
 	}
 }
+
+// Deliver logs the provided units.
+func (t Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	t.Alert(units...)
+	return nil
+}
@@ -0,0 +1,344 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("discord", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// limits imposed by discord on a single message.
+const (
+	maxEmbeds      = 10
+	maxCharacters  = 6000
+	maxTitle       = 256
+	maxDescription = 4096
+	maxFields      = 25
+	maxFieldName   = 256
+	maxFieldValue  = 1024
+)
+
+// embed colors.
+const (
+	ColorResolved   = 0x2eb67d
+	ColorFailed     = 0xe01e5a
+	ColorRestarting = 0xecb22e
+	ColorOther      = 0x36c5f0
+)
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Username:   "systemd-alert",
+		MaxRetries: 3,
+		Timeout:    10 * time.Second,
+	}
+}
+
+// Alerter - posts an embed per unit to a discord webhook, batches exceeding
+// discord's limits are split across several messages.
+type Alerter struct {
+	Webhook    string
+	Username   string
+	AvatarURL  string
+	MaxRetries int // attempts after being rate limited
+	Timeout    time.Duration
+	client     *http.Client
+}
+
+// UnmarshalTOML decodes the discord configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlDiscord struct {
+		Webhook    string
+		Username   string
+		AvatarURL  string
+		MaxRetries *int
+		Timeout    string
+	}
+
+	var (
+		err error
+		dec tomlDiscord
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid discord timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	if dec.Username != "" {
+		t.Username = dec.Username
+	}
+
+	if dec.MaxRetries != nil {
+		t.MaxRetries = *dec.MaxRetries
+	}
+
+	t.Webhook = dec.Webhook
+	t.AvatarURL = dec.AvatarURL
+
+	return nil
+}
+
+// Validate the webhook is configured.
+func (t *Alerter) Validate() error {
+	if u, err := url.Parse(t.Webhook); err != nil || u.Host == "" {
+		return errors.Errorf("invalid discord webhook %q", t.Webhook)
+	}
+
+	if t.MaxRetries < 0 {
+		return errors.Errorf("invalid discord max_retries %d", t.MaxRetries)
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve posts about the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver the provided units to the webhook.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+type field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type footer struct {
+	Text string `json:"text"`
+}
+
+type embed struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	Color       int     `json:"color"`
+	Fields      []field `json:"fields,omitempty"`
+	Footer      *footer `json:"footer,omitempty"`
+}
+
+// size of the embed as counted against the character limit of a message.
+func (t embed) size() (n int) {
+	n = len([]rune(t.Title)) + len([]rune(t.Description))
+	for _, f := range t.Fields {
+		n += len([]rune(f.Name)) + len([]rune(f.Value))
+	}
+
+	if t.Footer != nil {
+		n += len([]rune(t.Footer.Text))
+	}
+
+	return n
+}
+
+type payload struct {
+	Username  string  `json:"username,omitempty"`
+	AvatarURL string  `json:"avatar_url,omitempty"`
+	Embeds    []embed `json:"embeds"`
+}
+
+func (t *Alerter) send(b message.Batch) error {
+	for _, embeds := range split(t.embeds(b)) {
+		p := payload{Username: t.Username, AvatarURL: t.AvatarURL, Embeds: embeds}
+		if err := t.post(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Alerter) embeds(b message.Batch) []embed {
+	host := b.Host.Name()
+
+	labels := make([]string, 0, len(b.Host.Labels))
+	for k := range b.Host.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+
+	embeds := make([]embed, 0, len(b.Units))
+	for _, u := range b.Units {
+		fields := []field{
+			{Name: "State", Value: u.ActiveState, Inline: true},
+			{Name: "Sub-State", Value: u.SubState, Inline: true},
+			{Name: "Severity", Value: u.Severity, Inline: true},
+			{Name: "Host", Value: host, Inline: true},
+		}
+
+		if u.Owner != "" {
+			fields = append(fields, field{Name: "Owner", Value: u.Owner, Inline: true})
+		}
+
+		for _, k := range labels {
+			if len(fields) == maxFields {
+				break
+			}
+
+			fields = append(fields, field{Name: k, Value: b.Host.Labels[k], Inline: true})
+		}
+
+		for i := range fields {
+			fields[i].Name = message.Truncate(fields[i].Name, maxFieldName)
+			fields[i].Value = message.Truncate(fields[i].Value, maxFieldValue)
+			// discord rejects empty field values.
+			if fields[i].Value == "" {
+				fields[i].Value = "-"
+			}
+		}
+
+		embeds = append(embeds, embed{
+			Title:       message.Truncate(fmt.Sprintf("%s %s", u.Label, b.Status), maxTitle),
+			Description: message.Truncate(fmt.Sprintf("%s is %s (%s) on %s", u.Label, u.ActiveState, u.SubState, host), maxDescription),
+			URL:         u.Runbook,
+			Color:       Color(u, b.Resolved),
+			Fields:      fields,
+			Footer:      &footer{Text: "systemd-alert"},
+		})
+	}
+
+	return embeds
+}
+
+// split the embeds into messages respecting discord's limits on the number of
+// embeds and characters per message.
+func split(embeds []embed) (messages [][]embed) {
+	var (
+		current []embed
+		size    int
+	)
+
+	for _, e := range embeds {
+		if len(current) == maxEmbeds || (len(current) > 0 && size+e.size() > maxCharacters) {
+			messages = append(messages, current)
+			current, size = nil, 0
+		}
+
+		current = append(current, e)
+		size += e.size()
+	}
+
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+
+	return messages
+}
+
+func (t *Alerter) post(p payload) (err error) {
+	var (
+		raw  []byte
+		resp *http.Response
+	)
+
+	if raw, err = json.Marshal(p); err != nil {
+		return errors.Wrap(err, "failed to encode discord message")
+	}
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if resp, err = t.client.Post(t.Webhook, "application/json", bytes.NewReader(raw)); err != nil {
+			return errors.Wrap(err, "failed to send discord message")
+		}
+
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < t.MaxRetries:
+			// never wait longer than a request may take, the batch is
+			// dropped instead of holding up the following batches.
+			delay := retryAfter(resp.Header, body)
+			if delay > t.Timeout {
+				return errors.Errorf("discord webhook rate limited for %s, longer than the %s timeout", delay, t.Timeout)
+			}
+
+			time.Sleep(delay)
+			continue
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			return errors.Errorf("discord webhook failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		}
+
+		return nil
+	}
+}
+
+// retryAfter reads the delay requested by a rate limited response, the body
+// is more precise than the header.
+func retryAfter(header http.Header, body []byte) time.Duration {
+	var (
+		limited struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+	)
+
+	if err := json.Unmarshal(body, &limited); err == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	return time.Second
+}
+
+// Color of the embed for the state of the unit.
+func Color(u message.Unit, resolved bool) int {
+	switch {
+	case resolved:
+		return ColorResolved
+	case u.ActiveState == "failed":
+		return ColorFailed
+	case u.SubState == "auto-restart":
+		return ColorRestarting
+	default:
+		return ColorOther
+	}
+}
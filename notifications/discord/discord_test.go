@@ -0,0 +1,157 @@
+package discord_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/discord"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+type payload struct {
+	Username string `json:"username"`
+	Embeds   []struct {
+		Title  string `json:"title"`
+		URL    string `json:"url"`
+		Color  int    `json:"color"`
+		Fields []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+	} `json:"embeds"`
+}
+
+func next(t *testing.T, requests <-chan notifytest.Request) (p payload) {
+	r := <-requests
+	r.Decode(t, &p)
+	return p
+}
+
+// rateLimited responds with the provided status codes in order, repeating the
+// last.
+func rateLimited(statuses ...int) func(int, notifytest.Request) notifytest.Response {
+	return func(n int, r notifytest.Request) notifytest.Response {
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+
+		if statuses[n] != http.StatusTooManyRequests {
+			return notifytest.Response{Status: statuses[n]}
+		}
+
+		return notifytest.Response{
+			Status: http.StatusTooManyRequests,
+			Header: map[string]string{"Retry-After": "1"},
+			Body:   `{"message": "You are being rate limited.", "retry_after": 0.01, "global": false}`,
+		}
+	}
+}
+
+var (
+	host   = &systemd.Host{Hostname: "web1", Labels: map[string]string{"team": "platform"}}
+	failed = &systemd.UnitStatus{
+		Name:        "nginx.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Host:        host,
+		Settings:    &systemd.AlertSettings{Runbook: "https://wiki.example.com/nginx"},
+	}
+)
+
+func TestDeliver(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusNoContent)
+	a := discord.NewAlerter()
+	notifytest.Decode(t, a, `webhook = "`+srv.URL+`"`)
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	p := next(t, requests)
+	if p.Username != "systemd-alert" || len(p.Embeds) != 1 {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+
+	e := p.Embeds[0]
+	if e.Title != "nginx.service firing" || e.Color != discord.ColorFailed || e.URL != "https://wiki.example.com/nginx" {
+		t.Errorf("unexpected embed %+v", e)
+	}
+
+	if last := e.Fields[len(e.Fields)-1]; last.Name != "team" || last.Value != "platform" {
+		t.Errorf("expected the host labels as fields, got %+v", e.Fields)
+	}
+
+	a.Resolve(failed)
+
+	if p = next(t, requests); p.Embeds[0].Color != discord.ColorResolved {
+		t.Errorf("unexpected resolved color %x", p.Embeds[0].Color)
+	}
+}
+
+func TestDeliverSplitsBatches(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusNoContent)
+	a := discord.NewAlerter()
+	notifytest.Decode(t, a, `webhook = "`+srv.URL+`"`)
+
+	units := make([]*systemd.UnitStatus, 0, 23)
+	for i := 0; i < 23; i++ {
+		units = append(units, &systemd.UnitStatus{Name: fmt.Sprintf("worker@%02d.service", i), ActiveState: "activating", SubState: "auto-restart", Host: host})
+	}
+
+	if err := a.Deliver(units...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []int{10, 10, 3} {
+		if p := next(t, requests); len(p.Embeds) != expected {
+			t.Fatalf("expected %d embeds, got %d", expected, len(p.Embeds))
+		}
+	}
+}
+
+func TestDeliverRateLimited(t *testing.T) {
+	srv, requests := notifytest.Handle(t, rateLimited(http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusNoContent))
+	a := discord.NewAlerter()
+	notifytest.Decode(t, a, `webhook = "`+srv.URL+`"`)
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected the rate limited message to be retried twice, got %d requests", len(requests))
+	}
+}
+
+func TestDeliverRateLimitExhausted(t *testing.T) {
+	srv, _ := notifytest.Handle(t, rateLimited(http.StatusTooManyRequests))
+	a := discord.NewAlerter()
+	notifytest.Decode(t, a, `
+webhook = "`+srv.URL+`"
+max_retries = 1
+`)
+
+	if err := a.Deliver(failed); err == nil {
+		t.Fatal("expected exhausting the retries to fail")
+	}
+}
+
+func TestDeliverRateLimitTooLong(t *testing.T) {
+	srv, requests := notifytest.Handle(t, rateLimited(http.StatusTooManyRequests))
+	a := discord.NewAlerter()
+	notifytest.Decode(t, a, `
+webhook = "`+srv.URL+`"
+timeout = "5ms"
+`)
+
+	if err := a.Deliver(failed); err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("expected a delay longer than the timeout to fail, got %v", err)
+	}
+
+	if len(requests) != 1 {
+		t.Errorf("expected the message to not be retried, got %d requests", len(requests))
+	}
+}
@@ -0,0 +1,440 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("email", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// connection security.
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "implicit"
+	TLSNone     = "none"
+)
+
+const defaultSubject = `[{{ .Severity }}] {{ .Host.Hostname }}: {{ range $i, $u := .Units }}{{ if $i }}, {{ end }}{{ $u.Label }}{{ end }} {{ .Status }}`
+
+const defaultText = `{{ .Status }} on {{ .Host.Hostname }}
+{{ if .Host.MachineID }}machine-id: {{ .Host.MachineID }}
+{{ end }}{{ if .Host.BootID }}boot-id: {{ .Host.BootID }}
+{{ end }}{{ range $k, $v := .Host.Labels }}{{ $k }}: {{ $v }}
+{{ end }}{{ range .Units }}
+{{ .Label }}: {{ .ActiveState }} - {{ .SubState }} ({{ .Severity }})
+{{ if .Owner }}owner: {{ .Owner }}
+{{ end }}{{ if .Runbook }}runbook: {{ .Runbook }}
+{{ end }}{{ end }}`
+
+const defaultHTML = `<p><strong>{{ .Status }}</strong> on <strong>{{ .Host.Hostname }}</strong></p>
+<table>
+{{ if .Host.MachineID }}<tr><th align="left">machine-id</th><td>{{ .Host.MachineID }}</td></tr>
+{{ end }}{{ if .Host.BootID }}<tr><th align="left">boot-id</th><td>{{ .Host.BootID }}</td></tr>
+{{ end }}{{ range $k, $v := .Host.Labels }}<tr><th align="left">{{ $k }}</th><td>{{ $v }}</td></tr>
+{{ end }}</table>
+<table>
+<tr><th align="left">unit</th><th align="left">state</th><th align="left">severity</th><th align="left">owner</th><th align="left">runbook</th></tr>
+{{ range .Units }}<tr><td>{{ .Label }}</td><td>{{ .ActiveState }} - {{ .SubState }}</td><td>{{ .Severity }}</td><td>{{ .Owner }}</td><td>{{ if .Runbook }}<a href="{{ .Runbook }}">runbook</a>{{ end }}</td></tr>
+{{ end }}</table>
+`
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		TLS:     TLSStartTLS,
+		Timeout: 30 * time.Second,
+		subject: template.Must(template.New("subject").Funcs(message.Funcs()).Parse(defaultSubject)),
+		text:    template.Must(template.New("text").Funcs(message.Funcs()).Parse(defaultText)),
+		html:    htmltemplate.Must(htmltemplate.New("html").Funcs(message.Funcs()).Parse(defaultHTML)),
+	}
+}
+
+// Alerter - sends an email per batch over SMTP.
+type Alerter struct {
+	Address  string // smtp server, host:port
+	TLS      string // starttls (default), implicit or none
+	Username string
+	Password string
+	Auth     string // plain (default) or login
+	From     string
+	To       []string
+	Subject  string // text/template rendering the subject
+	Text     string // text/template rendering the text part
+	HTML     string // html/template rendering the html part
+	Timeout  time.Duration
+	subject  *template.Template
+	text     *template.Template
+	html     *htmltemplate.Template
+}
+
+// UnmarshalTOML decodes the email configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlEmail struct {
+		Address  string
+		TLS      string
+		Username string
+		Password string
+		Auth     string
+		From     string
+		To       []string
+		Subject  string
+		Text     string
+		HTML     string
+		Timeout  string
+	}
+
+	var (
+		err error
+		dec tomlEmail
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return notifications.KeyError{Key: "timeout", Err: errors.Errorf("invalid email timeout %q: %v", dec.Timeout, err)}
+		}
+	}
+
+	if dec.Subject != "" {
+		if t.subject, err = template.New("subject").Funcs(message.Funcs()).Parse(dec.Subject); err != nil {
+			return notifications.KeyError{Key: "subject", Err: errors.Wrap(err, "invalid email subject template")}
+		}
+	}
+
+	if dec.Text != "" {
+		if t.text, err = template.New("text").Funcs(message.Funcs()).Parse(dec.Text); err != nil {
+			return notifications.KeyError{Key: "text", Err: errors.Wrap(err, "invalid email text template")}
+		}
+	}
+
+	if dec.HTML != "" {
+		if t.html, err = htmltemplate.New("html").Funcs(message.Funcs()).Parse(dec.HTML); err != nil {
+			return notifications.KeyError{Key: "html", Err: errors.Wrap(err, "invalid email html template")}
+		}
+	}
+
+	if dec.TLS != "" {
+		t.TLS = strings.ToLower(dec.TLS)
+	}
+
+	t.Address = dec.Address
+	t.Username = dec.Username
+	t.Password = dec.Password
+	t.Auth = strings.ToLower(dec.Auth)
+	t.From = dec.From
+	t.To = dec.To
+	t.Subject = dec.Subject
+	t.Text = dec.Text
+	t.HTML = dec.HTML
+
+	return nil
+}
+
+// Validate the server, sender and recipients are configured.
+func (t *Alerter) Validate() error {
+	if _, _, err := net.SplitHostPort(t.Address); err != nil {
+		return errors.Errorf("invalid email address %q, expected host:port", t.Address)
+	}
+
+	switch t.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return errors.Errorf("invalid email tls %q, expected starttls, implicit or none", t.TLS)
+	}
+
+	switch t.Auth {
+	case "", "plain", "login":
+	default:
+		return errors.Errorf("invalid email auth %q, expected plain or login", t.Auth)
+	}
+
+	if _, err := mail.ParseAddress(t.From); err != nil {
+		return errors.Errorf("invalid email from %q", t.From)
+	}
+
+	if len(t.To) == 0 {
+		return errors.New("email requires at least one recipient")
+	}
+
+	for _, to := range t.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return errors.Errorf("invalid email recipient %q", to)
+		}
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve sends an email about the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver an email about the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		msg    []byte
+		client *smtp.Client
+	)
+
+	if msg, err = t.render(b, time.Now()); err != nil {
+		return err
+	}
+
+	if client, err = t.dial(); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = t.authenticate(client); err != nil {
+		return err
+	}
+
+	if err = t.transmit(client, msg); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (t *Alerter) dial() (client *smtp.Client, err error) {
+	var (
+		conn net.Conn
+	)
+
+	host, _, _ := net.SplitHostPort(t.Address)
+	config := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{Timeout: t.Timeout}
+
+	if t.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.Address, config)
+	} else {
+		conn, err = dialer.Dial("tcp", t.Address)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to smtp server")
+	}
+
+	if t.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(t.Timeout))
+	}
+
+	if client, err = smtp.NewClient(conn, host); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to establish smtp session")
+	}
+
+	if t.TLS == TLSStartTLS {
+		if err = client.StartTLS(config); err != nil {
+			client.Close()
+			return nil, errors.Wrap(err, "failed to start tls")
+		}
+	}
+
+	return client, nil
+}
+
+func (t *Alerter) authenticate(client *smtp.Client) error {
+	var (
+		auth smtp.Auth
+	)
+
+	if t.Username == "" {
+		return nil
+	}
+
+	host, _, _ := net.SplitHostPort(t.Address)
+	switch t.Auth {
+	case "login":
+		auth = loginAuth{username: t.Username, password: t.Password, host: host}
+	default:
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+
+	return errors.Wrap(client.Auth(auth), "smtp authentication failed")
+}
+
+func (t *Alerter) transmit(client *smtp.Client, msg []byte) error {
+	from, _ := mail.ParseAddress(t.From)
+	if err := client.Mail(from.Address); err != nil {
+		return errors.Wrap(err, "smtp server rejected the sender")
+	}
+
+	for _, to := range t.To {
+		recipient, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return errors.Wrapf(err, "smtp server rejected recipient %s", recipient.Address)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "smtp server rejected the message")
+	}
+
+	if _, err = w.Write(msg); err != nil {
+		w.Close()
+		return errors.Wrap(err, "failed to write message")
+	}
+
+	return errors.Wrap(w.Close(), "smtp server rejected the message")
+}
+
+// render the message with a text and html part.
+func (t *Alerter) render(b message.Batch, now time.Time) (_ []byte, err error) {
+	var (
+		subject, text, html bytes.Buffer
+		msg                 bytes.Buffer
+		part                = textproto.MIMEHeader{}
+	)
+
+	if err = t.subject.Execute(&subject, b); err != nil {
+		return nil, errors.Wrap(err, "failed to render email subject")
+	}
+
+	if err = t.text.Execute(&text, b); err != nil {
+		return nil, errors.Wrap(err, "failed to render email text")
+	}
+
+	if err = t.html.Execute(&html, b); err != nil {
+		return nil, errors.Wrap(err, "failed to render email html")
+	}
+
+	body := multipart.NewWriter(&msg)
+
+	headers := []string{
+		"From: " + t.From,
+		"To: " + strings.Join(t.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())),
+		"Date: " + now.Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%d.%s>", now.UnixNano(), t.domain()),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + body.Boundary(),
+	}
+	header := strings.Join(headers, "\r\n") + "\r\n\r\n"
+
+	for _, p := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		part.Set("Content-Type", p.contentType)
+		part.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		w, err := body.CreatePart(part)
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write(p.content); err != nil {
+			return nil, err
+		}
+
+		if err = qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = body.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(header), msg.Bytes()...), nil
+}
+
+func (t *Alerter) domain() string {
+	if from, err := mail.ParseAddress(t.From); err == nil {
+		if i := strings.LastIndex(from.Address, "@"); i != -1 {
+			return from.Address[i+1:]
+		}
+	}
+
+	return "systemd-alert"
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp
+// does not provide.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (t loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// same protection as smtp.PlainAuth, never send credentials in the clear
+	// to anything but localhost.
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != t.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (t loginAuth) Next(challenge []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(challenge))) {
+	case "username:":
+		return []byte(t.username), nil
+	case "password:":
+		return []byte(t.password), nil
+	default:
+		return nil, errors.Errorf("unexpected LOGIN challenge %q", challenge)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
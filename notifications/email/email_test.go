@@ -0,0 +1,231 @@
+package email_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/email"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/naoina/toml"
+)
+
+type envelope struct {
+	auth []string
+	from string
+	to   []string
+	data string
+}
+
+// smtpd is a minimal stand-in for an smtp server, it accepts any credentials
+// and records a single transaction per connection.
+func smtpd(t *testing.T) (string, <-chan envelope) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	envelopes := make(chan envelope, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go session(textproto.NewConn(conn), envelopes)
+		}
+	}()
+
+	return l.Addr().String(), envelopes
+}
+
+func session(c *textproto.Conn, envelopes chan<- envelope) {
+	var (
+		e envelope
+	)
+	defer c.Close()
+
+	c.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO":
+			c.PrintfLine("250-localhost")
+			c.PrintfLine("250 AUTH PLAIN LOGIN")
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH PLAIN"):
+			raw, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[2])
+			e.auth = append([]string{"PLAIN"}, strings.Split(string(raw), "\x00")[1:]...)
+			c.PrintfLine("235 ok")
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH LOGIN"):
+			e.auth = []string{"LOGIN"}
+			for _, prompt := range []string{"Username:", "Password:"} {
+				c.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+				answer, _ := c.ReadLine()
+				raw, _ := base64.StdEncoding.DecodeString(answer)
+				e.auth = append(e.auth, string(raw))
+			}
+			c.PrintfLine("235 ok")
+		case cmd == "MAIL":
+			e.from = strings.Trim(strings.SplitN(line, ":", 2)[1], "<>")
+			c.PrintfLine("250 ok")
+		case cmd == "RCPT":
+			e.to = append(e.to, strings.Trim(strings.SplitN(line, ":", 2)[1], "<>"))
+			c.PrintfLine("250 ok")
+		case cmd == "DATA":
+			c.PrintfLine("354 go ahead")
+			raw, _ := c.ReadDotBytes()
+			e.data = string(raw)
+			c.PrintfLine("250 ok")
+			envelopes <- e
+		case cmd == "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("502 unsupported")
+		}
+	}
+}
+
+var unit = &systemd.UnitStatus{
+	Name:        "nginx.service",
+	ActiveState: "failed",
+	SubState:    "failed",
+	Host:        &systemd.Host{Hostname: "web1", MachineID: "abc123"},
+	Settings:    &systemd.AlertSettings{Owner: "platform", Runbook: "https://wiki.example.com/nginx"},
+}
+
+// parts of the message keyed by content type.
+func parts(t *testing.T, data string) (*mail.Message, map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediatype, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediatype != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q", msg.Header.Get("Content-Type"))
+	}
+
+	found := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+
+		raw, _ := ioutil.ReadAll(p)
+		mediatype, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		found[mediatype] = string(raw)
+	}
+
+	return msg, found
+}
+
+func TestDeliver(t *testing.T) {
+	addr, envelopes := smtpd(t)
+	a := email.NewAlerter()
+	notifytest.Decode(t, a, `
+address = "`+addr+`"
+tls = "none"
+username = "agent"
+password = "hunter2"
+from = "systemd-alert <alerts@example.com>"
+to = ["ops@example.com", "Oncall <oncall@example.com>"]
+`)
+
+	if err := a.Deliver(unit); err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-envelopes
+	if strings.Join(e.auth, ",") != "PLAIN,agent,hunter2" {
+		t.Errorf("unexpected authentication %v", e.auth)
+	}
+
+	if e.from != "alerts@example.com" || strings.Join(e.to, ",") != "ops@example.com,oncall@example.com" {
+		t.Fatalf("unexpected envelope %s -> %v", e.from, e.to)
+	}
+
+	msg, found := parts(t, e.data)
+	if subject := msg.Header.Get("Subject"); subject != "[critical] web1: nginx.service firing" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+
+	if text := found["text/plain"]; !strings.Contains(text, "nginx.service: failed - failed (critical)") || !strings.Contains(text, "machine-id: abc123") || !strings.Contains(text, "owner: platform") {
+		t.Errorf("unexpected text part %q", text)
+	}
+
+	if html := found["text/html"]; !strings.Contains(html, `<a href="https://wiki.example.com/nginx">`) {
+		t.Errorf("unexpected html part %q", html)
+	}
+}
+
+func TestResolveLoginTemplate(t *testing.T) {
+	addr, envelopes := smtpd(t)
+	a := email.NewAlerter()
+	notifytest.Decode(t, a, `
+address = "`+addr+`"
+tls = "none"
+auth = "login"
+username = "agent"
+password = "hunter2"
+from = "alerts@example.com"
+to = ["ops@example.com"]
+subject = "{{ .Status }}: {{ .Host.Hostname }}"
+text = "{{ range $i, $u := .Units }}{{ if $i }}, {{ end }}{{ $u.Label }} {{ $u.SubState }}{{ end }}"
+`)
+
+	a.Resolve(unit)
+
+	e := <-envelopes
+	if strings.Join(e.auth, ",") != "LOGIN,agent,hunter2" {
+		t.Errorf("unexpected authentication %v", e.auth)
+	}
+
+	msg, found := parts(t, e.data)
+	if subject := msg.Header.Get("Subject"); subject != "resolved: web1" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+
+	if text := found["text/plain"]; text != "nginx.service failed" {
+		t.Errorf("unexpected text part %q", text)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, config := range []string{
+		"address = \"smtp.example.com\"\nfrom = \"a@example.com\"\nto = [\"b@example.com\"]",
+		"address = \"smtp.example.com:25\"\ntls = \"ssl\"\nfrom = \"a@example.com\"\nto = [\"b@example.com\"]",
+		"address = \"smtp.example.com:25\"\nfrom = \"a@example.com\"",
+		"address = \"smtp.example.com:25\"\nfrom = \"a@example.com\"\nto = [\"nope\"]",
+	} {
+		tbl, err := toml.Parse([]byte(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a := email.NewAlerter()
+		if err = toml.UnmarshalTable(tbl, a); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = a.Validate(); err == nil {
+			t.Errorf("expected %q to be invalid", config)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package forward
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// NewCollector receives batches from agents, passing units that match the
+// filter on to the notifiers.
+func NewCollector(filter func(*systemd.UnitStatus) bool, notifiers ...alerts.Notifier) *Collector {
+	return &Collector{
+		m:         &sync.Mutex{},
+		filter:    filter,
+		notifiers: alerts.NewSettings(nil, notifiers...),
+		active:    make(map[string]*systemd.UnitStatus),
+	}
+}
+
+// Collector - http handler for batches forwarded by agents. alerts are
+// deduplicated across hosts and retried deliveries, and queued for the
+// notifiers one host at a time so a slow notifier doesn't hold up agents.
+type Collector struct {
+	m         *sync.Mutex
+	filter    func(*systemd.UnitStatus) bool
+	notifiers *alerts.Settings
+	active    map[string]*systemd.UnitStatus
+}
+
+func (t *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		b Batch
+	)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		log.Println("failed to decode batch", err)
+		http.Error(w, "invalid batch", http.StatusBadRequest)
+		return
+	}
+
+	t.Receive(b)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Receive a batch from an agent, it returns once the batch was deduplicated
+// and queued for the notifiers.
+func (t *Collector) Receive(b Batch) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, units := range byHost(t.dedup(b)) {
+		if b.Resolved {
+			t.notifiers.Resolve(units...)
+		} else {
+			t.notifiers.Alert(units...)
+		}
+	}
+}
+
+// dedup must be called while holding the lock.
+func (t *Collector) dedup(b Batch) []*systemd.UnitStatus {
+	units := make([]*systemd.UnitStatus, 0, len(b.Units))
+	for _, unit := range b.Units {
+		k := key(unit)
+		previous, alerted := t.active[k]
+
+		if b.Resolved {
+			if alerted {
+				delete(t.active, k)
+				units = append(units, unit)
+			}
+			continue
+		}
+
+		if !t.filter(unit) {
+			continue
+		}
+
+		if alerted && previous.ActiveState == unit.ActiveState && previous.SubState == unit.SubState {
+			continue
+		}
+
+		t.active[k] = unit
+		units = append(units, unit)
+	}
+
+	return units
+}
+
+func byHost(units []*systemd.UnitStatus) map[string][]*systemd.UnitStatus {
+	hosts := make(map[string][]*systemd.UnitStatus)
+	for _, unit := range units {
+		h := unit.Host.String()
+		hosts[h] = append(hosts[h], unit)
+	}
+	return hosts
+}
+
+func key(unit *systemd.UnitStatus) string {
+	return unit.Host.String() + "/" + unit.Label()
+}
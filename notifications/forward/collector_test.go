@@ -0,0 +1,155 @@
+package forward_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/systemdtest"
+	"github.com/james-lawrence/systemd-alert/notifications/forward"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+func failed(name, host string) *systemd.UnitStatus {
+	return &systemd.UnitStatus{Name: name, ActiveState: "failed", SubState: "failed", Host: &systemd.Host{Hostname: host}}
+}
+
+func recovered(name, host string) *systemd.UnitStatus {
+	return &systemd.UnitStatus{Name: name, ActiveState: "active", SubState: "running", Host: &systemd.Host{Hostname: host}}
+}
+
+func TestCollectorDedup(t *testing.T) {
+	rec := systemdtest.NewRecorder()
+	c := forward.NewCollector(alerts.IgnoreServices("ignored.service"), rec)
+
+	c.Receive(forward.Batch{Units: []*systemd.UnitStatus{failed("nginx.service", "web1"), failed("nginx.service", "web2"), failed("ignored.service", "web1")}})
+
+	hosts := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		units := systemdtest.Next(rec.Alerts, timeout)
+		if len(units) != 1 || units[0].Name != "nginx.service" {
+			t.Fatalf("expected a batch per host, got %v", units)
+		}
+		hosts[units[0].Host.Hostname] = true
+	}
+
+	if !hosts["web1"] || !hosts["web2"] {
+		t.Fatalf("expected an alert for each host, got %v", hosts)
+	}
+
+	// a retried delivery of the same state is not alerted again.
+	c.Receive(forward.Batch{Units: []*systemd.UnitStatus{failed("nginx.service", "web1")}})
+	if units := systemdtest.Next(rec.Alerts, 50*time.Millisecond); units != nil {
+		t.Fatalf("unexpected duplicate alert %v", units)
+	}
+
+	c.Receive(forward.Batch{Resolved: true, Units: []*systemd.UnitStatus{recovered("nginx.service", "web1"), recovered("ignored.service", "web1")}})
+	if units := systemdtest.Next(rec.Resolved, timeout); len(units) != 1 || units[0].Host.Hostname != "web1" {
+		t.Fatalf("expected only the alerted unit to be resolved, got %v", units)
+	}
+
+	c.Receive(forward.Batch{Resolved: true, Units: []*systemd.UnitStatus{recovered("nginx.service", "web1")}})
+	if units := systemdtest.Next(rec.Resolved, 50*time.Millisecond); units != nil {
+		t.Fatalf("unexpected duplicate resolve %v", units)
+	}
+
+	// once resolved the unit alerts again.
+	c.Receive(forward.Batch{Units: []*systemd.UnitStatus{failed("nginx.service", "web1")}})
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 {
+		t.Fatalf("expected the unit to alert again, got %v", units)
+	}
+}
+
+func TestCollectorSilences(t *testing.T) {
+	rec := systemdtest.NewRecorder()
+	c := forward.NewCollector(forward.IgnoreSilenced(
+		forward.Silence{Unit: "nginx.service", Host: "web*"},
+		forward.Silence{Host: "db1", Until: time.Now().Add(time.Hour)},
+		forward.Silence{Unit: "worker.service", Until: time.Now().Add(-time.Hour)},
+	), rec)
+
+	c.Receive(forward.Batch{Units: []*systemd.UnitStatus{
+		failed("nginx.service", "web1"),
+		failed("postgres.service", "db1"),
+		failed("worker.service", "db2"),
+		failed("nginx.service", "lb1"),
+	}})
+
+	names := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		for _, u := range systemdtest.Next(rec.Alerts, timeout) {
+			names[u.Name+"@"+u.Host.Hostname] = true
+		}
+	}
+
+	if len(names) != 2 || !names["worker.service@db2"] || !names["nginx.service@lb1"] {
+		t.Fatalf("expected only units without an active silence to alert, got %v", names)
+	}
+}
+
+func TestCollectorServeHTTP(t *testing.T) {
+	rec := systemdtest.NewRecorder()
+	srv := httptest.NewServer(forward.NewCollector(alerts.IgnoreServices(), rec))
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected only posts to be accepted, got %v %v", resp, err)
+	}
+
+	if resp, err := http.Post(srv.URL, "application/json", bytes.NewReader([]byte("{"))); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an invalid batch to be rejected, got %v %v", resp, err)
+	}
+
+	raw, err := json.Marshal(forward.Batch{Units: []*systemd.UnitStatus{failed("nginx.service", "web1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := http.Post(srv.URL, "application/json", bytes.NewReader(raw)); err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the batch to be accepted, got %v %v", resp, err)
+	}
+
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the batch to be delivered, got %v", units)
+	}
+}
+
+// blocked is a notifier that holds every alert until it is released.
+type blocked struct {
+	release chan struct{}
+	alerts  chan []*systemd.UnitStatus
+}
+
+func (t blocked) Alert(units ...*systemd.UnitStatus) {
+	<-t.release
+	t.alerts <- units
+}
+
+func TestCollectorQueuesDeliveries(t *testing.T) {
+	n := blocked{release: make(chan struct{}), alerts: make(chan []*systemd.UnitStatus, 2)}
+	c := forward.NewCollector(alerts.IgnoreServices(), n)
+
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		c.Receive(forward.Batch{Units: []*systemd.UnitStatus{failed("nginx.service", "web1")}})
+		c.Receive(forward.Batch{Units: []*systemd.UnitStatus{failed("nginx.service", "web2")}})
+	}()
+
+	select {
+	case <-received:
+	case <-time.After(timeout):
+		t.Fatal("expected batches to be received while a notifier is blocked")
+	}
+
+	close(n.release)
+	for _, host := range []string{"web1", "web2"} {
+		if units := systemdtest.Next(n.alerts, timeout); len(units) != 1 || units[0].Host.Hostname != host {
+			t.Fatalf("expected the queued alerts to be delivered in order, got %v", units)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package forward
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("forward", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// Batch is the wire format between agents and the collector.
+type Batch struct {
+	Resolved bool                  `json:"resolved"`
+	Units    []*systemd.UnitStatus `json:"units"`
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Spool:   "/var/spool/systemd-alert",
+		m:       &sync.Mutex{},
+		sending: &sync.Mutex{},
+		once:    &sync.Once{},
+		stop:    &sync.Once{},
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Alerter - forwards alerts to a central collector over HTTPS with mutual TLS.
+// batches are spooled to disk and delivered in order, so alerts raised while
+// the collector is unreachable are sent once it returns.
+type Alerter struct {
+	URL         string // collector endpoint, e.g. https://collector.example.com:8443
+	CA          string // certificate authority used to verify the collector
+	Certificate string // client certificate presented to the collector
+	Key         string // client certificate key
+	Spool       string // directory holding undelivered batches
+	m           *sync.Mutex
+	sending     *sync.Mutex // held while delivering spooled batches
+	once        *sync.Once
+	stop        *sync.Once
+	done        chan struct{}
+	wake        chan struct{} // signals batches were spooled
+	client      *http.Client
+	sequence    uint64
+}
+
+// Validate the collector endpoint and credentials are configured.
+func (t *Alerter) Validate() error {
+	switch {
+	case t.URL == "":
+		return errors.New("forward url is required")
+	case t.CA == "":
+		return errors.New("forward ca is required")
+	case t.Certificate == "":
+		return errors.New("forward certificate is required")
+	case t.Key == "":
+		return errors.New("forward key is required")
+	}
+
+	return nil
+}
+
+// Start delivers any batches spooled by a previous run, batches as they are
+// spooled, and retries undelivered batches periodically.
+func (t *Alerter) Start() {
+	t.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(10 * time.Second)
+			defer ticker.Stop()
+
+			t.retry()
+			for {
+				select {
+				case <-ticker.C:
+					t.retry()
+				case <-t.wake:
+					t.retry()
+				case <-t.done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop retrying undelivered batches, they remain spooled for the next run.
+func (t *Alerter) Stop() {
+	t.stop.Do(func() {
+		close(t.done)
+	})
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	t.forward(Batch{Units: units})
+}
+
+// Deliver forwards the provided units directly, bypassing the spool, and
+// reports whether the collector accepted them.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.Send(Batch{Units: units})
+}
+
+// Send posts the batch to the collector, bypassing the spool. an undelivered
+// batch is not retried.
+func (t *Alerter) Send(b Batch) error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode batch")
+	}
+
+	t.sending.Lock()
+	defer t.sending.Unlock()
+
+	return errors.Wrap(t.post(raw), "failed to forward batch")
+}
+
+// Resolve forwards the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	t.forward(Batch{Resolved: true, Units: units})
+}
+
+// DeliverResolve forwards the recovery of the provided units directly,
+// bypassing the spool, and reports whether the collector accepted it.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.Send(Batch{Resolved: true, Units: units})
+}
+
+// forward spools the batch for delivery by the goroutine started by Start.
+func (t *Alerter) forward(b Batch) {
+	if err := t.spool(b); err != nil {
+		log.Println(errors.Wrap(err, "failed to spool batch"))
+		return
+	}
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Alerter) retry() {
+	if err := t.flush(); err != nil {
+		log.Println(err)
+	}
+}
+
+func (t *Alerter) spool(b Batch) (err error) {
+	var (
+		raw []byte
+	)
+
+	if raw, err = json.Marshal(b); err != nil {
+		return errors.Wrap(err, "failed to encode batch")
+	}
+
+	if err = os.MkdirAll(t.Spool, 0700); err != nil {
+		return err
+	}
+
+	t.m.Lock()
+	t.sequence++
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), t.sequence)
+	t.m.Unlock()
+
+	// write to a hidden file first so a partially written batch is never sent.
+	tmp := filepath.Join(t.Spool, "."+name)
+	if err = ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(t.Spool, name))
+}
+
+// flush delivers spooled batches in order, stopping at the first failure.
+func (t *Alerter) flush() (err error) {
+	var (
+		names []string
+	)
+
+	t.sending.Lock()
+	defer t.sending.Unlock()
+
+	if names, err = filepath.Glob(filepath.Join(t.Spool, "*.json")); err != nil {
+		return errors.Wrap(err, "failed to read spool")
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if err = t.deliver(name); err != nil {
+			return errors.Wrapf(err, "failed to forward batch, %d batches spooled", len(names)-i)
+		}
+
+		if err = os.Remove(name); err != nil {
+			return errors.Wrap(err, "failed to remove delivered batch")
+		}
+	}
+
+	return nil
+}
+
+// deliver must be called while holding the sending lock.
+func (t *Alerter) deliver(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return t.post(raw)
+}
+
+// post must be called while holding the sending lock.
+func (t *Alerter) post(raw []byte) (err error) {
+	var (
+		resp *http.Response
+	)
+
+	if t.client == nil {
+		if t.client, err = t.httpClient(); err != nil {
+			return err
+		}
+	}
+
+	if resp, err = t.client.Post(t.URL, "application/json", bytes.NewReader(raw)); err != nil {
+		return errors.Wrap(err, "failed to post batch")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return errors.Errorf("collector rejected batch with status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (t *Alerter) httpClient() (*http.Client, error) {
+	var (
+		err  error
+		cert tls.Certificate
+		pool *x509.CertPool
+	)
+
+	if cert, err = tls.LoadX509KeyPair(t.Certificate, t.Key); err != nil {
+		return nil, errors.Wrap(err, "failed to load client certificate")
+	}
+
+	if pool, err = CertPool(t.CA); err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				RootCAs:      pool,
+			},
+		},
+	}, nil
+}
+
+// CertPool loads the certificate authority at the given path.
+func CertPool(path string) (*x509.CertPool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read certificate authority")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, errors.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
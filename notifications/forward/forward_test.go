@@ -0,0 +1,313 @@
+package forward_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/internal/systemdtest"
+	"github.com/james-lawrence/systemd-alert/notifications/forward"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+const timeout = 2 * time.Second
+
+// authority issues the certificates of the collector and its agents.
+type authority struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newAuthority(t *testing.T, dir string) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "systemd-alert"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	write(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", raw)
+
+	return &authority{dir: dir, cert: cert, key: key, pool: pool}
+}
+
+// issue a certificate for the name, returning the paths of the certificate
+// and its key.
+func (t *authority) issue(tb *testing.T, name string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, t.cert, &key.PublicKey, t.key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	encoded, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	certificate, pkey := filepath.Join(t.dir, name+".pem"), filepath.Join(t.dir, name+".key")
+	write(tb, certificate, "CERTIFICATE", raw)
+	write(tb, pkey, "EC PRIVATE KEY", encoded)
+
+	pair, err := tls.LoadX509KeyPair(certificate, pkey)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return pair, certificate, pkey
+}
+
+func write(t *testing.T, path, kind string, raw []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempdir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+// collector serves the handler over https, requiring agents to present a
+// certificate issued by the authority.
+func collector(t *testing.T, ca *authority, handler http.Handler) *httptest.Server {
+	cert, _, _ := ca.issue(t, "collector", x509.ExtKeyUsageServerAuth)
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// agent configures a forwarder with a certificate issued by the authority.
+func agent(t *testing.T, ca *authority, url string) (*forward.Alerter, string) {
+	_, cert, key := ca.issue(t, "agent", x509.ExtKeyUsageClientAuth)
+	spool := filepath.Join(tempdir(t), "spool")
+
+	a := forward.NewAlerter()
+	notifytest.Decode(t, a, `
+url = "`+url+`"
+ca = "`+filepath.Join(ca.dir, "ca.pem")+`"
+certificate = "`+cert+`"
+key = "`+key+`"
+spool = "`+spool+`"
+`)
+
+	return a, spool
+}
+
+// spooled waits for the number of batches in the spool to reach n.
+func spooled(t *testing.T, spool string, n int) {
+	deadline := time.Now().Add(timeout)
+	for {
+		names, err := filepath.Glob(filepath.Join(spool, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(names) == n {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d spooled batches, got %d", n, len(names))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var unit = &systemd.UnitStatus{
+	Name:        "nginx.service",
+	ActiveState: "failed",
+	SubState:    "failed",
+	Host:        &systemd.Host{Hostname: "web1", MachineID: "abc123"},
+}
+
+func TestForwardMutualTLS(t *testing.T) {
+	ca := newAuthority(t, tempdir(t))
+	rec := systemdtest.NewRecorder()
+	srv := collector(t, ca, forward.NewCollector(alerts.IgnoreServices(), rec))
+
+	a, _ := agent(t, ca, srv.URL)
+	a.Start()
+	defer a.Stop()
+
+	a.Alert(unit)
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 || units[0].Name != "nginx.service" || units[0].Host.MachineID != "abc123" {
+		t.Fatalf("expected the unit and its host to be forwarded, got %v", units)
+	}
+
+	// agents holding a certificate from another authority are rejected.
+	untrusted := newAuthority(t, tempdir(t))
+	_, cert, key := untrusted.issue(t, "agent", x509.ExtKeyUsageClientAuth)
+	b := forward.NewAlerter()
+	notifytest.Decode(t, b, `
+url = "`+srv.URL+`"
+ca = "`+filepath.Join(ca.dir, "ca.pem")+`"
+certificate = "`+cert+`"
+key = "`+key+`"
+spool = "`+filepath.Join(tempdir(t), "spool")+`"
+`)
+
+	if err := b.Deliver(unit); err == nil {
+		t.Fatal("expected the collector to reject an untrusted agent")
+	}
+
+	if units := systemdtest.Next(rec.Alerts, 50*time.Millisecond); units != nil {
+		t.Fatalf("unexpected alert from an untrusted agent %v", units)
+	}
+}
+
+func TestForwardSpoolsWhileUnreachable(t *testing.T) {
+	var (
+		available int32
+	)
+
+	ca := newAuthority(t, tempdir(t))
+	rec := systemdtest.NewRecorder()
+	c := forward.NewCollector(alerts.IgnoreServices(), rec)
+	srv := collector(t, ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		c.ServeHTTP(w, r)
+	}))
+
+	a, spool := agent(t, ca, srv.URL)
+	a.Start()
+	defer a.Stop()
+
+	a.Alert(unit)
+	spooled(t, spool, 1)
+
+	atomic.StoreInt32(&available, 1)
+
+	// the spooled alert is delivered ahead of the resolve.
+	a.Resolve(unit)
+
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the spooled alert to be delivered, got %v", units)
+	}
+
+	if units := systemdtest.Next(rec.Resolved, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the resolve to be delivered, got %v", units)
+	}
+
+	spooled(t, spool, 0)
+}
+
+func TestForwardReplaysSpool(t *testing.T) {
+	ca := newAuthority(t, tempdir(t))
+	rec := systemdtest.NewRecorder()
+	srv := collector(t, ca, forward.NewCollector(alerts.IgnoreServices(), rec))
+
+	// batches spooled by a previous run, e.g. the collector was down when the
+	// agent stopped, are delivered once the agent starts.
+	previous, spool := agent(t, ca, "https://127.0.0.1:1")
+	previous.Alert(unit)
+	spooled(t, spool, 1)
+
+	a, _ := agent(t, ca, srv.URL)
+	a.Spool = spool
+	a.Start()
+	defer a.Stop()
+
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the spooled alert to be replayed, got %v", units)
+	}
+
+	spooled(t, spool, 0)
+}
+
+func TestDeliverBypassesSpool(t *testing.T) {
+	ca := newAuthority(t, tempdir(t))
+	rec := systemdtest.NewRecorder()
+	srv := collector(t, ca, forward.NewCollector(alerts.IgnoreServices(), rec))
+
+	unreachable, spool := agent(t, ca, "https://127.0.0.1:1")
+	if err := unreachable.Deliver(unit); err == nil {
+		t.Fatal("expected delivery to an unreachable collector to fail")
+	}
+	spooled(t, spool, 0)
+
+	a, spool := agent(t, ca, srv.URL)
+	if err := a.Send(forward.Batch{Resolved: true, Units: []*systemd.UnitStatus{unit}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Deliver(unit); err != nil {
+		t.Fatal(err)
+	}
+	spooled(t, spool, 0)
+
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected the unit to be delivered, got %v", units)
+	}
+}
@@ -0,0 +1,56 @@
+package forward
+
+import (
+	"path"
+	"time"
+
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// Silence mutes alerts about matching units, e.g. during maintenance.
+type Silence struct {
+	Unit    string    // pattern matched against the unit name, every unit when empty
+	Host    string    // pattern matched against the hostname or machine-id, every host when empty
+	Until   time.Time // when the silence expires, never when zero
+	Comment string
+}
+
+// Matches reports if the silence mutes the unit at the given time.
+func (t Silence) Matches(unit *systemd.UnitStatus, now time.Time) bool {
+	if !t.Until.IsZero() && now.After(t.Until) {
+		return false
+	}
+
+	if t.Unit != "" && !match(t.Unit, unit.Name) {
+		return false
+	}
+
+	if t.Host == "" {
+		return true
+	}
+
+	if unit.Host == nil {
+		return false
+	}
+
+	return match(t.Host, unit.Host.Hostname) || match(t.Host, unit.Host.MachineID)
+}
+
+// IgnoreSilenced ignore units muted by any of the silences.
+func IgnoreSilenced(silences ...Silence) func(*systemd.UnitStatus) bool {
+	return func(unit *systemd.UnitStatus) bool {
+		now := time.Now()
+		for _, s := range silences {
+			if s.Matches(unit, now) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+func match(pattern, s string) bool {
+	matched, _ := path.Match(pattern, s)
+	return matched
+}
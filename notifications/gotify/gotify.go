@@ -0,0 +1,238 @@
+package gotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("gotify", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Priorities: Priorities(),
+		Timeout:    10 * time.Second,
+	}
+}
+
+// Priorities maps severities to gotify priorities, 0 (silent) to 10 (high).
+// recoveries use the resolved priority, unknown severities the warning one.
+func Priorities() map[string]int {
+	return map[string]int{
+		alerts.SeverityCritical: 8,
+		"error":                 6,
+		alerts.SeverityWarning:  5,
+		alerts.SeverityInfo:     2,
+		message.StatusResolved:  2,
+	}
+}
+
+// Alerter - pushes a message per batch to a gotify server.
+type Alerter struct {
+	Server     string // e.g. https://gotify.example.com
+	Token      string // application token
+	Markdown   bool   // render the message as markdown in the clients
+	Click      string // opened when the notification is clicked, defaults to the first runbook
+	Priorities map[string]int
+	Timeout    time.Duration
+	client     *http.Client
+}
+
+// UnmarshalTOML decodes the gotify configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlGotify struct {
+		Server     string
+		Token      string
+		Markdown   bool
+		Click      string
+		Priorities map[string]int
+		Timeout    string
+	}
+
+	var (
+		err error
+		dec tomlGotify
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid gotify timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	for severity, priority := range dec.Priorities {
+		t.Priorities[strings.ToLower(severity)] = priority
+	}
+
+	t.Server = strings.TrimSuffix(dec.Server, "/")
+	t.Token = dec.Token
+	t.Markdown = dec.Markdown
+	t.Click = dec.Click
+
+	return nil
+}
+
+// Validate the server, token and priorities.
+func (t *Alerter) Validate() error {
+	if u, err := url.Parse(t.Server); err != nil || u.Host == "" {
+		return errors.Errorf("invalid gotify server %q", t.Server)
+	}
+
+	if t.Token == "" {
+		return errors.New("gotify requires an application token")
+	}
+
+	for severity, priority := range t.Priorities {
+		if priority < 0 || priority > 10 {
+			return errors.Errorf("invalid gotify priority %d for %s, expected 0 to 10", priority, severity)
+		}
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve pushes a message about the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver a message about the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+type push struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+func (t *Alerter) push(b message.Batch) push {
+	var (
+		body strings.Builder
+	)
+
+	host := b.Host.Name()
+
+	click := t.Click
+	for _, u := range b.Units {
+		state := fmt.Sprintf("%s - %s (%s)", u.ActiveState, u.SubState, u.Severity)
+
+		switch {
+		case t.Markdown && u.Runbook != "":
+			fmt.Fprintf(&body, "- `%s`: %s [runbook](%s)\n", u.Label, state, u.Runbook)
+		case t.Markdown:
+			fmt.Fprintf(&body, "- `%s`: %s\n", u.Label, state)
+		default:
+			fmt.Fprintf(&body, "%s: %s\n", u.Label, state)
+		}
+
+		if click == "" {
+			click = u.Runbook
+		}
+	}
+
+	p := push{
+		Title:    fmt.Sprintf("%s: %d units on %s", b.Status, len(b.Units), host),
+		Message:  strings.TrimSpace(body.String()),
+		Priority: t.priority(b),
+		Extras:   map[string]interface{}{},
+	}
+
+	if t.Markdown {
+		p.Extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+
+	if click != "" {
+		p.Extras["client::notification"] = map[string]interface{}{"click": map[string]string{"url": click}}
+	}
+
+	return p
+}
+
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		raw  []byte
+		req  *http.Request
+		resp *http.Response
+	)
+
+	if raw, err = json.Marshal(t.push(b)); err != nil {
+		return errors.Wrap(err, "failed to encode gotify message")
+	}
+
+	if req, err = http.NewRequest(http.MethodPost, t.Server+"/message", bytes.NewReader(raw)); err != nil {
+		return errors.Wrap(err, "failed to create gotify request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", t.Token)
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Do(req); err != nil {
+		return errors.Wrap(err, "failed to push gotify message")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("gotify request failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+func (t *Alerter) priority(b message.Batch) int {
+	key := b.Severity
+	if b.Resolved {
+		key = message.StatusResolved
+	}
+
+	if p, ok := t.Priorities[key]; ok {
+		return p
+	}
+
+	return t.Priorities[alerts.SeverityWarning]
+}
@@ -0,0 +1,104 @@
+package gotify_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/gotify"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+type push struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras"`
+}
+
+type request struct {
+	path  string
+	token string
+	push  push
+}
+
+func next(t *testing.T, requests <-chan notifytest.Request) request {
+	r := <-requests
+	req := request{path: r.URL.Path, token: r.Header.Get("X-Gotify-Key")}
+	r.Decode(t, &req.push)
+	return req
+}
+
+var unit = &systemd.UnitStatus{
+	Name:        "nginx.service",
+	ActiveState: "failed",
+	SubState:    "failed",
+	Host:        &systemd.Host{Hostname: "web1"},
+	Settings:    &systemd.AlertSettings{Runbook: "https://wiki.example.com/nginx"},
+}
+
+func TestDeliver(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusOK)
+	a := gotify.NewAlerter()
+	notifytest.Decode(t, a, `
+server = "`+srv.URL+`/"
+token = "At0ken"
+`)
+
+	if err := a.Deliver(unit); err != nil {
+		t.Fatal(err)
+	}
+
+	r := next(t, requests)
+	if r.path != "/message" || r.token != "At0ken" {
+		t.Fatalf("unexpected request %s %s", r.path, r.token)
+	}
+
+	if r.push.Title != "firing: 1 units on web1" || r.push.Message != "nginx.service: failed - failed (critical)" || r.push.Priority != 8 {
+		t.Errorf("unexpected push %+v", r.push)
+	}
+
+	if _, ok := r.push.Extras["client::display"]; ok {
+		t.Errorf("expected plain text, got %v", r.push.Extras)
+	}
+}
+
+func TestDeliverMarkdown(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusOK)
+	a := gotify.NewAlerter()
+	notifytest.Decode(t, a, `
+server = "`+srv.URL+`"
+token = "At0ken"
+markdown = true
+priorities = { resolved = 0 }
+`)
+
+	a.Resolve(unit)
+
+	r := next(t, requests)
+	if r.push.Message != "- `nginx.service`: failed - failed (critical) [runbook](https://wiki.example.com/nginx)" || r.push.Priority != 0 {
+		t.Errorf("unexpected push %+v", r.push)
+	}
+
+	if display, _ := r.push.Extras["client::display"].(map[string]interface{}); display["contentType"] != "text/markdown" {
+		t.Errorf("expected markdown, got %v", r.push.Extras)
+	}
+
+	notification, _ := r.push.Extras["client::notification"].(map[string]interface{})
+	if click, _ := notification["click"].(map[string]interface{}); click["url"] != "https://wiki.example.com/nginx" {
+		t.Errorf("expected the runbook as the click url, got %v", r.push.Extras)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, _ := notifytest.Serve(t, http.StatusUnauthorized)
+	a := gotify.NewAlerter()
+	notifytest.Decode(t, a, `
+server = "`+srv.URL+`"
+token = "At0ken"
+`)
+
+	if err := a.Deliver(unit); err == nil {
+		t.Fatal("expected a rejected message to fail")
+	}
+}
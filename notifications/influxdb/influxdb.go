@@ -44,10 +44,27 @@ type Alerter struct {
 	client    clientX
 }
 
+// Validate the address uses a supported scheme.
+func (t *Alerter) Validate() error {
+	if !strings.HasPrefix(t.Address, "unix") && !strings.HasPrefix(t.Address, "http") {
+		return errors.Errorf("influxdb address %q must be a unix:// or http(s):// address", t.Address)
+	}
+
+	return nil
+}
+
 // Alert about the provided units.
 func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println("events written to endpoint")
+}
+
+// Deliver writes a point per unit to the endpoint.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) (err error) {
 	var (
-		err    error
 		points []*client.Point
 		batch  client.BatchPoints
 	)
@@ -68,8 +85,7 @@ func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
 	})
 
 	if t.client == nil {
-		log.Println("client is nil, skipping")
-		return
+		return errors.New("client is nil, skipping")
 	}
 
 	pconfig := client.BatchPointsConfig{
@@ -78,14 +94,18 @@ func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
 	}
 
 	if batch, err = client.NewBatchPoints(pconfig); err != nil {
-		log.Println("failed to create batch points", err)
-		return
+		return errors.Wrap(err, "failed to create batch points")
 	}
 
 	points = make([]*client.Point, 0, len(units))
 	for _, unit := range units {
 		var p *client.Point
-		p, err = client.NewPoint(t.Metric, map[string]string{}, map[string]interface{}{
+		tags := hostTags(unit.Host)
+		if unit.Source != "" {
+			tags["source"] = unit.Source
+		}
+
+		p, err = client.NewPoint(t.Metric, tags, map[string]interface{}{
 			"unit":         unit.Name,
 			"active_state": unit.ActiveState,
 			"sub_state":    unit.SubState,
@@ -100,8 +120,34 @@ func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
 	batch.AddPoints(points)
 
 	if err = t.client.Write(batch); err != nil {
-		log.Println(errors.Wrap(err, "failed to write events"))
-		return
+		return errors.Wrap(err, "failed to write events")
 	}
-	log.Println("events written to endpoint")
+
+	return nil
+}
+
+// hostTags identify the host the unit was observed on.
+func hostTags(h *systemd.Host) map[string]string {
+	tags := map[string]string{}
+	if h == nil {
+		return tags
+	}
+
+	for k, v := range h.Labels {
+		tags[k] = v
+	}
+
+	if h.Hostname != "" {
+		tags["hostname"] = h.Hostname
+	}
+
+	if h.MachineID != "" {
+		tags["machine_id"] = h.MachineID
+	}
+
+	if h.BootID != "" {
+		tags["boot_id"] = h.BootID
+	}
+
+	return tags
 }
@@ -0,0 +1,398 @@
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("matrix", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		MsgType:    "m.text",
+		MaxRetries: 3,
+		Timeout:    10 * time.Second,
+		m:          &sync.Mutex{},
+		sent:       map[string]*sent{},
+		events:     map[string]string{},
+	}
+}
+
+// Alerter - sends a m.room.message event per batch to a matrix room using
+// the client-server api. when edit is enabled the message about a unit is
+// edited once the unit resolves instead of sending a new message.
+type Alerter struct {
+	Homeserver  string // e.g. https://matrix.example.com
+	AccessToken string
+	Room        string // room id, e.g. !abcdef:example.com
+	MsgType     string // m.text (default) or m.notice
+	Edit        bool
+	MaxRetries  int // attempts after a failed request, reusing the transaction id
+	Timeout     time.Duration
+	client      *http.Client
+	txn         uint64
+	m           *sync.Mutex
+	sent        map[string]*sent  // event id -> units the event is about
+	events      map[string]string // unit label -> event id
+}
+
+// sent tracks the units of a message that may still be edited.
+type sent struct {
+	batch    message.Batch
+	resolved map[string]bool
+	pending  int // units that may still resolve
+}
+
+// UnmarshalTOML decodes the matrix configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlMatrix struct {
+		Homeserver  string
+		AccessToken string
+		Room        string
+		MsgType     string
+		Edit        bool
+		MaxRetries  *int
+		Timeout     string
+	}
+
+	var (
+		err error
+		dec tomlMatrix
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid matrix timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	if dec.MsgType != "" {
+		t.MsgType = dec.MsgType
+	}
+
+	if dec.MaxRetries != nil {
+		t.MaxRetries = *dec.MaxRetries
+	}
+
+	t.Homeserver = strings.TrimSuffix(dec.Homeserver, "/")
+	t.AccessToken = dec.AccessToken
+	t.Room = dec.Room
+	t.Edit = dec.Edit
+
+	return nil
+}
+
+// Validate the homeserver, token and room are configured.
+func (t *Alerter) Validate() error {
+	if u, err := url.Parse(t.Homeserver); err != nil || u.Host == "" {
+		return errors.Errorf("invalid matrix homeserver %q", t.Homeserver)
+	}
+
+	if t.AccessToken == "" {
+		return errors.New("matrix requires an access_token")
+	}
+
+	if !strings.HasPrefix(t.Room, "!") || !strings.Contains(t.Room, ":") {
+		return errors.Errorf("invalid matrix room %q, expected a room id, e.g. !abcdef:example.com", t.Room)
+	}
+
+	switch t.MsgType {
+	case "m.text", "m.notice":
+	default:
+		return errors.Errorf("invalid matrix msg_type %q, expected m.text or m.notice", t.MsgType)
+	}
+
+	if t.MaxRetries < 0 {
+		return errors.Errorf("invalid matrix max_retries %d", t.MaxRetries)
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve sends a message about the recovery of the provided units, or edits
+// the messages that alerted about them.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units, see Resolve.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) (err error) {
+	b := message.New(true, units...)
+
+	if t.Edit {
+		b, err = t.edit(b)
+	}
+
+	if err == nil && len(b.Units) > 0 {
+		_, err = t.send(content(t.MsgType, b, nil))
+	}
+
+	return err
+}
+
+// Deliver a message about the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	b := message.New(false, units...)
+
+	id, err := t.send(content(t.MsgType, b, nil))
+	if err != nil {
+		return err
+	}
+
+	if t.Edit {
+		t.track(id, b)
+	}
+
+	return nil
+}
+
+// track the units of an event so it can be edited once they resolve.
+func (t *Alerter) track(id string, b message.Batch) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.sent[id] = &sent{batch: b, resolved: map[string]bool{}, pending: len(b.Units)}
+	for _, u := range b.Units {
+		// a unit alerting again is only edited in its latest message.
+		if previous, ok := t.events[u.Label]; ok {
+			t.forget(previous, u.Label)
+		}
+		t.events[u.Label] = id
+	}
+}
+
+// forget the unit in the event, must be called with the lock held.
+func (t *Alerter) forget(id, label string) {
+	s, ok := t.sent[id]
+	if !ok {
+		return
+	}
+
+	if s.pending--; s.pending == 0 {
+		delete(t.sent, id)
+	}
+}
+
+// edit the messages that alerted about the resolved units, returns the units
+// without a message to edit.
+func (t *Alerter) edit(b message.Batch) (_ message.Batch, err error) {
+	type edit struct {
+		id  string
+		msg map[string]interface{}
+	}
+
+	var (
+		untracked []message.Unit
+		edits     []edit
+		ids       = map[string]bool{}
+	)
+
+	t.m.Lock()
+	for _, u := range b.Units {
+		id, ok := t.events[u.Label]
+		if !ok {
+			untracked = append(untracked, u)
+			continue
+		}
+
+		delete(t.events, u.Label)
+		t.sent[id].resolved[u.Label] = true
+		t.sent[id].pending--
+		ids[id] = true
+	}
+
+	for id := range ids {
+		s := t.sent[id]
+		edits = append(edits, edit{id: id, msg: content(t.MsgType, s.batch, s.resolved)})
+		if s.pending == 0 {
+			delete(t.sent, id)
+		}
+	}
+	t.m.Unlock()
+
+	for _, e := range edits {
+		replacement := map[string]interface{}{
+			"msgtype":        e.msg["msgtype"],
+			"body":           "* " + e.msg["body"].(string),
+			"format":         e.msg["format"],
+			"formatted_body": "* " + e.msg["formatted_body"].(string),
+			"m.new_content":  e.msg,
+			"m.relates_to": map[string]interface{}{
+				"rel_type": "m.replace",
+				"event_id": e.id,
+			},
+		}
+
+		if _, cause := t.send(replacement); cause != nil {
+			err = cause
+		}
+	}
+
+	b.Units = untracked
+
+	return b, err
+}
+
+// content of a message about the batch, units in resolved are marked as
+// recovered.
+func content(msgtype string, b message.Batch, resolved map[string]bool) map[string]interface{} {
+	var (
+		text, formatted strings.Builder
+	)
+
+	host := b.Host.Name()
+
+	status := b.Status
+	if len(resolved) == len(b.Units) && len(resolved) > 0 {
+		status = message.StatusResolved
+	}
+
+	fmt.Fprintf(&text, "%s: %d units on %s\n", status, len(b.Units), host)
+	fmt.Fprintf(&formatted, "<p><strong>%s</strong>: %d units on <strong>%s</strong></p>\n<ul>\n", html.EscapeString(status), len(b.Units), html.EscapeString(host))
+
+	for _, u := range b.Units {
+		state := fmt.Sprintf("%s - %s (%s)", u.ActiveState, u.SubState, u.Severity)
+		if resolved[u.Label] {
+			state = message.StatusResolved
+		}
+
+		fmt.Fprintf(&text, "%s: %s", u.Label, state)
+		fmt.Fprintf(&formatted, "<li><code>%s</code>: %s", html.EscapeString(u.Label), html.EscapeString(state))
+
+		if u.Owner != "" {
+			fmt.Fprintf(&text, " owner: %s", u.Owner)
+			fmt.Fprintf(&formatted, " owner: %s", html.EscapeString(u.Owner))
+		}
+
+		if u.Runbook != "" {
+			fmt.Fprintf(&text, " runbook: %s", u.Runbook)
+			fmt.Fprintf(&formatted, ` <a href="%s">runbook</a>`, html.EscapeString(u.Runbook))
+		}
+
+		text.WriteString("\n")
+		formatted.WriteString("</li>\n")
+	}
+
+	formatted.WriteString("</ul>")
+
+	return map[string]interface{}{
+		"msgtype":        msgtype,
+		"body":           strings.TrimSpace(text.String()),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted.String(),
+	}
+}
+
+// send the event to the room, retries reuse the transaction id so the
+// homeserver delivers the event at most once.
+func (t *Alerter) send(event map[string]interface{}) (id string, err error) {
+	var (
+		raw  []byte
+		req  *http.Request
+		resp *http.Response
+	)
+
+	if raw, err = json.Marshal(event); err != nil {
+		return "", errors.Wrap(err, "failed to encode matrix event")
+	}
+
+	txn := fmt.Sprintf("systemd-alert.%d.%d", time.Now().UnixNano(), atomic.AddUint64(&t.txn, 1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", t.Homeserver, url.PathEscape(t.Room), txn)
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if req, err = http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(raw)); err != nil {
+			return "", errors.Wrap(err, "failed to create matrix request")
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+
+		if resp, err = t.client.Do(req); err != nil {
+			if attempt < t.MaxRetries {
+				time.Sleep(backoff(attempt))
+				continue
+			}
+
+			return "", errors.Wrap(err, "failed to send matrix event")
+		}
+
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		switch {
+		case (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < t.MaxRetries:
+			time.Sleep(retryAfter(body, attempt))
+			continue
+		case resp.StatusCode < 200 || resp.StatusCode >= 300:
+			return "", errors.Errorf("matrix request failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+		}
+
+		var decoded struct {
+			EventID string `json:"event_id"`
+		}
+
+		if err = json.Unmarshal(body, &decoded); err != nil {
+			return "", errors.Wrap(err, "failed to decode matrix response")
+		}
+
+		return decoded.EventID, nil
+	}
+}
+
+// retryAfter reads the delay requested by a rate limited response.
+func retryAfter(body []byte, attempt int) time.Duration {
+	var (
+		limited struct {
+			RetryAfterMS int64 `json:"retry_after_ms"`
+		}
+	)
+
+	if err := json.Unmarshal(body, &limited); err == nil && limited.RetryAfterMS > 0 {
+		return time.Duration(limited.RetryAfterMS) * time.Millisecond
+	}
+
+	return backoff(attempt)
+}
+
+func backoff(attempt int) time.Duration {
+	return time.Duration(attempt+1) * 500 * time.Millisecond
+}
@@ -0,0 +1,166 @@
+package matrix_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/matrix"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+type request struct {
+	path string
+	auth string
+	body map[string]interface{}
+}
+
+func next(t *testing.T, requests <-chan notifytest.Request) request {
+	r := <-requests
+	if r.Method != http.MethodPut {
+		t.Errorf("unexpected method %s", r.Method)
+	}
+
+	req := request{path: r.URL.EscapedPath(), auth: r.Header.Get("Authorization")}
+	r.Decode(t, &req.body)
+	return req
+}
+
+// send responds to messages with the provided status codes in order,
+// repeating the last.
+func send(statuses ...int) func(int, notifytest.Request) notifytest.Response {
+	return func(n int, r notifytest.Request) notifytest.Response {
+		status := statuses[len(statuses)-1]
+		if n < len(statuses) {
+			status = statuses[n]
+		}
+
+		if status == http.StatusTooManyRequests {
+			return notifytest.Response{Status: status, Body: `{"errcode": "M_LIMIT_EXCEEDED", "retry_after_ms": 1}`}
+		}
+
+		return notifytest.Response{Status: status, Body: fmt.Sprintf(`{"event_id": "$event%d"}`, n+1)}
+	}
+}
+
+var (
+	host   = &systemd.Host{Hostname: "web1"}
+	failed = &systemd.UnitStatus{
+		Name:        "nginx.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Host:        host,
+	}
+	restarting = &systemd.UnitStatus{
+		Name:        "worker.service",
+		ActiveState: "activating",
+		SubState:    "auto-restart",
+		Host:        host,
+	}
+)
+
+func TestDeliver(t *testing.T) {
+	srv, requests := notifytest.Handle(t, send(http.StatusOK))
+	a := matrix.NewAlerter()
+	notifytest.Decode(t, a, `
+homeserver = "`+srv.URL+`/"
+access_token = "t0ken"
+room = "!abc:example.com"
+msg_type = "m.notice"
+`)
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	r := next(t, requests)
+	if !strings.HasPrefix(r.path, "/_matrix/client/v3/rooms/%21abc:example.com/send/m.room.message/") || r.auth != "Bearer t0ken" {
+		t.Fatalf("unexpected request %s %s", r.path, r.auth)
+	}
+
+	if r.body["msgtype"] != "m.notice" || r.body["format"] != "org.matrix.custom.html" {
+		t.Fatalf("unexpected event %v", r.body)
+	}
+
+	if body, _ := r.body["body"].(string); !strings.Contains(body, "nginx.service: failed - failed (critical)") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	if formatted, _ := r.body["formatted_body"].(string); !strings.Contains(formatted, "<code>nginx.service</code>") {
+		t.Errorf("unexpected formatted body %q", formatted)
+	}
+}
+
+func TestDeliverRetriesWithTransactionID(t *testing.T) {
+	srv, requests := notifytest.Handle(t, send(http.StatusTooManyRequests, http.StatusOK))
+	a := matrix.NewAlerter()
+	notifytest.Decode(t, a, `
+homeserver = "`+srv.URL+`"
+access_token = "t0ken"
+room = "!abc:example.com"
+`)
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := next(t, requests), next(t, requests)
+	if first.path != second.path {
+		t.Fatalf("expected retries to reuse the transaction id: %s != %s", first.path, second.path)
+	}
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if third := next(t, requests); third.path == first.path {
+		t.Fatal("expected a new transaction id for a new event")
+	}
+}
+
+func TestResolveEdits(t *testing.T) {
+	srv, requests := notifytest.Handle(t, send(http.StatusOK))
+	a := matrix.NewAlerter()
+	notifytest.Decode(t, a, `
+homeserver = "`+srv.URL+`"
+access_token = "t0ken"
+room = "!abc:example.com"
+edit = true
+`)
+
+	if err := a.Deliver(failed, restarting); err != nil {
+		t.Fatal(err)
+	}
+	next(t, requests)
+
+	a.Resolve(failed)
+
+	r := next(t, requests)
+	relates, _ := r.body["m.relates_to"].(map[string]interface{})
+	if relates["rel_type"] != "m.replace" || relates["event_id"] != "$event1" {
+		t.Fatalf("expected an edit of the alert, got %v", r.body)
+	}
+
+	replacement, _ := r.body["m.new_content"].(map[string]interface{})
+	body, _ := replacement["body"].(string)
+	if !strings.HasPrefix(body, "firing:") || !strings.Contains(body, "nginx.service: resolved") || !strings.Contains(body, "worker.service: activating") {
+		t.Errorf("unexpected replacement %q", body)
+	}
+
+	a.Resolve(restarting)
+
+	r = next(t, requests)
+	replacement, _ = r.body["m.new_content"].(map[string]interface{})
+	if body, _ = replacement["body"].(string); !strings.HasPrefix(body, "resolved:") {
+		t.Errorf("expected the alert to be resolved, got %q", body)
+	}
+
+	// units without a tracked message are resolved with a new message.
+	a.Resolve(failed)
+
+	if r = next(t, requests); r.body["m.relates_to"] != nil {
+		t.Errorf("expected a new message, got %v", r.body)
+	}
+}
@@ -0,0 +1,156 @@
+// Package message describes a batch of units for notifiers that render
+// templates or send JSON payloads.
+package message
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// statuses of a batch.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Host identifies the machine the batch was observed on.
+type Host struct {
+	Hostname  string            `json:"hostname,omitempty"`
+	MachineID string            `json:"machine_id,omitempty"`
+	BootID    string            `json:"boot_id,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Name of the host for display, the hostname falling back to the machine-id.
+func (t Host) Name() string {
+	if t.Hostname != "" {
+		return t.Hostname
+	}
+
+	return t.MachineID
+}
+
+// ID identifies the host across alerts, the machine-id is preferred over the
+// hostname since it survives renames.
+func (t Host) ID() string {
+	if t.MachineID != "" {
+		return t.MachineID
+	}
+
+	return t.Hostname
+}
+
+// Unit describes a unit in the batch.
+type Unit struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Source      string `json:"source,omitempty"`
+	LoadState   string `json:"load_state,omitempty"`
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+	Result      string `json:"result,omitempty"`
+	Restarts    uint32 `json:"restarts,omitempty"`
+	Severity    string `json:"severity"`
+	Owner       string `json:"owner,omitempty"`
+	Runbook     string `json:"runbook,omitempty"`
+	Route       string `json:"route,omitempty"`
+}
+
+// Batch - the units delivered to a notifier at once. every unit in a batch
+// was observed on the same host.
+type Batch struct {
+	Status   string `json:"status"`
+	Resolved bool   `json:"resolved"`
+	Severity string `json:"severity"` // the highest severity of the units
+	Host     Host   `json:"host"`
+	Units    []Unit `json:"units"`
+}
+
+// New describes the units.
+func New(resolved bool, units ...*systemd.UnitStatus) Batch {
+	b := Batch{
+		Status:   StatusFiring,
+		Resolved: resolved,
+		Severity: alerts.SeverityInfo,
+		Units:    make([]Unit, 0, len(units)),
+	}
+
+	if resolved {
+		b.Status = StatusResolved
+	}
+
+	for _, u := range units {
+		if u.Host != nil && b.Host.Hostname == "" && b.Host.MachineID == "" {
+			b.Host = Host{Hostname: u.Host.Hostname, MachineID: u.Host.MachineID, BootID: u.Host.BootID, Labels: u.Host.Labels}
+		}
+
+		unit := Unit{
+			Name:        u.Name,
+			Label:       u.Label(),
+			Source:      u.Source,
+			LoadState:   u.LoadState,
+			ActiveState: u.ActiveState,
+			SubState:    u.SubState,
+			Result:      u.Result,
+			Restarts:    u.NRestarts,
+			Severity:    alerts.Severity(u),
+		}
+
+		if u.Settings != nil {
+			unit.Owner = u.Settings.Owner
+			unit.Runbook = u.Settings.Runbook
+			unit.Route = u.Settings.Route
+		}
+
+		if Rank(unit.Severity) > Rank(b.Severity) {
+			b.Severity = unit.Severity
+		}
+
+		b.Units = append(b.Units, unit)
+	}
+
+	sort.Slice(b.Units, func(i, j int) bool { return b.Units[i].Label < b.Units[j].Label })
+
+	return b
+}
+
+// Rank orders severities, unknown severities rank between info and warning.
+func Rank(severity string) int {
+	switch severity {
+	case alerts.SeverityCritical:
+		return 3
+	case alerts.SeverityWarning:
+		return 2
+	case alerts.SeverityInfo:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Truncate the text to at most n characters.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n])
+}
+
+// Funcs available to templates rendering a batch.
+func Funcs() map[string]interface{} {
+	return map[string]interface{}{
+		"json": func(v interface{}) (string, error) {
+			raw, err := json.Marshal(v)
+			return string(raw), err
+		},
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
@@ -0,0 +1,34 @@
+package message_test
+
+import (
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+)
+
+func TestHost(t *testing.T) {
+	h := message.Host{Hostname: "web1", MachineID: "abc123"}
+	if h.Name() != "web1" || h.ID() != "abc123" {
+		t.Errorf("unexpected host name %q and id %q", h.Name(), h.ID())
+	}
+
+	h = message.Host{MachineID: "abc123"}
+	if h.Name() != "abc123" {
+		t.Errorf("expected the name to fall back to the machine-id, got %q", h.Name())
+	}
+
+	h = message.Host{Hostname: "web1"}
+	if h.ID() != "web1" {
+		t.Errorf("expected the id to fall back to the hostname, got %q", h.ID())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if s := message.Truncate("héllo", 2); s != "hé" {
+		t.Errorf("expected truncation by character, got %q", s)
+	}
+
+	if s := message.Truncate("hello", 10); s != "hello" {
+		t.Errorf("unexpected truncation %q", s)
+	}
+}
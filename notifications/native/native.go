@@ -10,6 +10,7 @@ import (
 	alerts "github.com/james-lawrence/systemd-alert"
 	"github.com/james-lawrence/systemd-alert/notifications"
 	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
 )
 
 func init() {
@@ -68,31 +69,60 @@ func (t *Alerter) ensureConn() {
 	}
 }
 
+// Stop closes the session bus connection.
+func (t *Alerter) Stop() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
 // Alert about the provided units.
 func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Deliver a desktop notification per unit.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) (failed error) {
 	t.ensureConn()
 
+	if t.conn == nil {
+		return errors.New("native notifications are disabled, no session bus")
+	}
+
 	for _, unit := range units {
 		var (
 			err error
 			id  uint32
 		)
 
-		if replace, ok := t.current[unit.Name]; ok {
+		if replace, ok := t.current[unit.Label()]; ok {
 			id = replace
 		}
 
+		summary := fmt.Sprintf("%s %s - %s", unit.Label(), unit.ActiveState, unit.SubState)
+		if unit.Host != nil && unit.Host.Hostname != "" {
+			summary = unit.Host.Hostname + ": " + summary
+		}
+
 		n := notify.Notification{
 			AppName:    "Systemd Alert",
 			ReplacesID: id,
-			Summary:    fmt.Sprintf("%s %s - %s", unit.Name, unit.ActiveState, unit.SubState),
+			Summary:    summary,
 		}
 
 		if id, err = notify.SendNotification(t.conn, n); err != nil {
-			log.Println("notification failed", err)
+			failed = errors.Wrap(err, "notification failed")
 			continue
 		}
 
-		t.current[unit.Name] = id
+		t.current[unit.Label()] = id
 	}
+
+	return failed
 }
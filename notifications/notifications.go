@@ -9,3 +9,20 @@ var Plugins = map[string]creator{}
 func Add(name string, creator creator) {
 	Plugins[name] = creator
 }
+
+// Validator is implemented by notifiers that can check their configuration
+// once it has been decoded, e.g. for missing required fields.
+type Validator interface {
+	Validate() error
+}
+
+// KeyError locates a problem with a notifier's configuration, or any other
+// table, on the key it was declared on rather than on the table.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (t KeyError) Error() string {
+	return t.Err.Error()
+}
@@ -0,0 +1,228 @@
+package ntfy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("ntfy", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Priorities: Priorities(),
+		Timeout:    10 * time.Second,
+	}
+}
+
+// Priorities maps severities to ntfy priorities, 1 (min) to 5 (urgent).
+// recoveries use the resolved priority, unknown severities the default.
+func Priorities() map[string]int {
+	return map[string]int{
+		alerts.SeverityCritical: 5,
+		"error":                 4,
+		alerts.SeverityWarning:  4,
+		alerts.SeverityInfo:     2,
+		message.StatusResolved:  2,
+	}
+}
+
+// Alerter - publishes a message per batch to a ntfy topic.
+type Alerter struct {
+	Topic      string   // topic url, e.g. https://ntfy.sh/alerts
+	Tags       []string // added to the severity tag, e.g. emoji short codes
+	Click      string   // opened when the notification is clicked, defaults to the first runbook
+	Token      string   // bearer authentication
+	Username   string   // basic authentication
+	Password   string
+	Priorities map[string]int
+	Timeout    time.Duration
+	client     *http.Client
+}
+
+// UnmarshalTOML decodes the ntfy configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlNtfy struct {
+		Topic      string
+		Tags       []string
+		Click      string
+		Token      string
+		Username   string
+		Password   string
+		Priorities map[string]int
+		Timeout    string
+	}
+
+	var (
+		err error
+		dec tomlNtfy
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid ntfy timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	for severity, priority := range dec.Priorities {
+		t.Priorities[strings.ToLower(severity)] = priority
+	}
+
+	t.Topic = dec.Topic
+	t.Tags = dec.Tags
+	t.Click = dec.Click
+	t.Token = dec.Token
+	t.Username = dec.Username
+	t.Password = dec.Password
+
+	return nil
+}
+
+// Validate the topic, authentication and priorities.
+func (t *Alerter) Validate() error {
+	if u, err := url.Parse(t.Topic); err != nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return errors.Errorf("invalid ntfy topic %q, expected a topic url, e.g. https://ntfy.sh/alerts", t.Topic)
+	}
+
+	if t.Token != "" && (t.Username != "" || t.Password != "") {
+		return errors.New("ntfy can use either basic or bearer authentication, not both")
+	}
+
+	for severity, priority := range t.Priorities {
+		if priority < 1 || priority > 5 {
+			return errors.Errorf("invalid ntfy priority %d for %s, expected 1 to 5", priority, severity)
+		}
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve publishes a message about the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver a message about the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+		body strings.Builder
+	)
+
+	host := b.Host.Name()
+
+	click := t.Click
+	for _, u := range b.Units {
+		fmt.Fprintf(&body, "%s: %s - %s (%s)\n", u.Label, u.ActiveState, u.SubState, u.Severity)
+		if click == "" {
+			click = u.Runbook
+		}
+	}
+
+	if req, err = http.NewRequest(http.MethodPost, t.Topic, strings.NewReader(strings.TrimSpace(body.String()))); err != nil {
+		return errors.Wrap(err, "failed to create ntfy request")
+	}
+
+	// non-ascii header values must be encoded, ntfy decodes rfc 2047.
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", fmt.Sprintf("%s: %d units on %s", b.Status, len(b.Units), host)))
+	req.Header.Set("Priority", strconv.Itoa(t.priority(b)))
+	req.Header.Set("Tags", strings.Join(append([]string{tag(b)}, t.Tags...), ","))
+
+	if click != "" {
+		req.Header.Set("Click", click)
+	}
+
+	switch {
+	case t.Token != "":
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	case t.Username != "" || t.Password != "":
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Do(req); err != nil {
+		return errors.Wrap(err, "failed to publish ntfy message")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		raw, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("ntfy request failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(raw))
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+func (t *Alerter) priority(b message.Batch) int {
+	key := b.Severity
+	if b.Resolved {
+		key = message.StatusResolved
+	}
+
+	if p, ok := t.Priorities[key]; ok {
+		return p
+	}
+
+	return 3
+}
+
+// tag of the batch, rendered as an emoji by ntfy.
+func tag(b message.Batch) string {
+	switch {
+	case b.Resolved:
+		return "white_check_mark"
+	case b.Severity == alerts.SeverityCritical:
+		return "rotating_light"
+	case b.Severity == alerts.SeverityInfo:
+		return "information_source"
+	default:
+		return "warning"
+	}
+}
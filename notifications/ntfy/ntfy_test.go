@@ -0,0 +1,99 @@
+package ntfy_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/ntfy"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+var (
+	host   = &systemd.Host{Hostname: "web1"}
+	failed = &systemd.UnitStatus{
+		Name:        "nginx.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Host:        host,
+		Settings:    &systemd.AlertSettings{Runbook: "https://wiki.example.com/nginx"},
+	}
+	restarting = &systemd.UnitStatus{
+		Name:        "worker.service",
+		ActiveState: "activating",
+		SubState:    "auto-restart",
+		Host:        host,
+	}
+)
+
+func TestDeliver(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusOK)
+	a := ntfy.NewAlerter()
+	notifytest.Decode(t, a, `
+topic = "`+srv.URL+`/alerts"
+token = "tk_t0ken"
+tags = ["systemd"]
+`)
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-requests
+	if r.URL.Path != "/alerts" || r.Header.Get("Authorization") != "Bearer tk_t0ken" {
+		t.Fatalf("unexpected request %s %v", r.URL.Path, r.Header)
+	}
+
+	if r.Header.Get("Title") != "firing: 1 units on web1" || r.Header.Get("Priority") != "5" || r.Header.Get("Tags") != "rotating_light,systemd" {
+		t.Errorf("unexpected headers %v", r.Header)
+	}
+
+	if r.Header.Get("Click") != "https://wiki.example.com/nginx" {
+		t.Errorf("expected the runbook as the click url, got %q", r.Header.Get("Click"))
+	}
+
+	if string(r.Body) != "nginx.service: failed - failed (critical)" {
+		t.Errorf("unexpected body %q", r.Body)
+	}
+}
+
+func TestDeliverPriorities(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusOK)
+	a := ntfy.NewAlerter()
+	notifytest.Decode(t, a, `
+topic = "`+srv.URL+`/alerts"
+username = "agent"
+password = "hunter2"
+click = "https://status.example.com"
+priorities = { warning = 3, resolved = 1 }
+`)
+
+	if err := a.Deliver(restarting); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-requests
+	if user, pass, ok := (&http.Request{Header: r.Header}).BasicAuth(); !ok || user != "agent" || pass != "hunter2" {
+		t.Errorf("expected basic authentication, got %q", r.Header.Get("Authorization"))
+	}
+
+	if r.Header.Get("Priority") != "3" || r.Header.Get("Click") != "https://status.example.com" {
+		t.Errorf("unexpected headers %v", r.Header)
+	}
+
+	a.Resolve(restarting)
+
+	if r = <-requests; r.Header.Get("Priority") != "1" || r.Header.Get("Tags") != "white_check_mark" {
+		t.Errorf("unexpected headers %v", r.Header)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, _ := notifytest.Serve(t, http.StatusForbidden)
+	a := ntfy.NewAlerter()
+	notifytest.Decode(t, a, `topic = "`+srv.URL+`/alerts"`)
+
+	if err := a.Deliver(failed); err == nil {
+		t.Fatal("expected a rejected message to fail")
+	}
+}
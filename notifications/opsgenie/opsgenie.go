@@ -0,0 +1,286 @@
+package opsgenie
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("opsgenie", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// api base urls.
+const (
+	DefaultURL = "https://api.opsgenie.com"
+	EUURL      = "https://api.eu.opsgenie.com"
+)
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		URL:     DefaultURL,
+		Source:  "systemd-alert",
+		Timeout: 10 * time.Second,
+	}
+}
+
+// Alerter - creates an opsgenie alert per unit and closes it when the unit
+// recovers.
+type Alerter struct {
+	APIKey  string   // key of an api integration
+	URL     string   // api base url, defaults to DefaultURL
+	Source  string   // source of the alerts
+	Tags    []string // added to the tags derived from the host labels
+	Timeout time.Duration
+	client  *http.Client
+}
+
+// UnmarshalTOML decodes the opsgenie configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlOpsgenie struct {
+		APIKey  string
+		URL     string
+		Source  string
+		Tags    []string
+		Timeout string
+	}
+
+	var (
+		err error
+		dec tomlOpsgenie
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid opsgenie timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	if dec.URL != "" {
+		t.URL = strings.TrimSuffix(dec.URL, "/")
+	}
+
+	if dec.Source != "" {
+		t.Source = dec.Source
+	}
+
+	t.APIKey = dec.APIKey
+	t.Tags = dec.Tags
+
+	return nil
+}
+
+// Validate the api key and url are configured.
+func (t *Alerter) Validate() error {
+	if t.APIKey == "" {
+		return errors.New("opsgenie requires an api_key")
+	}
+
+	if u, err := url.Parse(t.URL); err != nil || u.Host == "" {
+		return errors.Errorf("invalid opsgenie url %q", t.URL)
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve closes the alerts of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve closes the alerts of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) (err error) {
+	var (
+		failed int
+	)
+
+	b := message.New(true, units...)
+	for _, u := range b.Units {
+		endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", t.URL, url.PathEscape(Alias(b.Host, u)))
+		body := closure{Source: t.Source, Note: u.Label + " recovered"}
+		if cause := t.post(endpoint, body); cause != nil {
+			failed++
+			err = cause
+		}
+	}
+
+	if failed > 0 {
+		return errors.Wrapf(err, "failed to close %d of %d opsgenie alerts", failed, len(b.Units))
+	}
+
+	return nil
+}
+
+// Deliver creates an alert for each of the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) (err error) {
+	var (
+		failed int
+	)
+
+	b := message.New(false, units...)
+	for _, u := range b.Units {
+		if cause := t.post(t.URL+"/v2/alerts", t.alert(b, u)); cause != nil {
+			failed++
+			err = cause
+		}
+	}
+
+	if failed > 0 {
+		return errors.Wrapf(err, "failed to create %d of %d opsgenie alerts", failed, len(b.Units))
+	}
+
+	return nil
+}
+
+type alert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	Priority    string            `json:"priority"`
+}
+
+type closure struct {
+	Source string `json:"source,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+func (t *Alerter) alert(b message.Batch, u message.Unit) alert {
+	host := b.Host.Name()
+
+	details := map[string]string{
+		"unit":         u.Label,
+		"load_state":   u.LoadState,
+		"active_state": u.ActiveState,
+		"sub_state":    u.SubState,
+		"result":       u.Result,
+		"severity":     u.Severity,
+		"owner":        u.Owner,
+		"route":        u.Route,
+		"runbook":      u.Runbook,
+		"hostname":     b.Host.Hostname,
+		"machine_id":   b.Host.MachineID,
+		"boot_id":      b.Host.BootID,
+	}
+
+	for k, v := range details {
+		if v == "" {
+			delete(details, k)
+		}
+	}
+
+	tags := append([]string(nil), t.Tags...)
+	for k, v := range b.Host.Labels {
+		tags = append(tags, k+":"+v)
+	}
+	sort.Strings(tags[len(t.Tags):])
+
+	description := fmt.Sprintf("%s is %s (%s) on %s", u.Label, u.ActiveState, u.SubState, host)
+	if u.Runbook != "" {
+		description += "\nrunbook: " + u.Runbook
+	}
+
+	return alert{
+		Message:     message.Truncate(fmt.Sprintf("%s %s on %s", u.Label, u.ActiveState, host), 130),
+		Alias:       Alias(b.Host, u),
+		Description: description,
+		Tags:        tags,
+		Details:     details,
+		Entity:      host,
+		Source:      t.Source,
+		Priority:    Priority(u.Severity),
+	}
+}
+
+func (t *Alerter) post(endpoint string, v interface{}) (err error) {
+	var (
+		raw  []byte
+		req  *http.Request
+		resp *http.Response
+	)
+
+	if raw, err = json.Marshal(v); err != nil {
+		return errors.Wrap(err, "failed to encode opsgenie request")
+	}
+
+	if req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(raw)); err != nil {
+		return errors.Wrap(err, "failed to create opsgenie request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+t.APIKey)
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Do(req); err != nil {
+		return errors.Wrap(err, "failed to send opsgenie request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("opsgenie request failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+// Alias identifies the alert of a unit on a host. opsgenie limits aliases to
+// 512 characters.
+func Alias(h message.Host, u message.Unit) string {
+	return message.Truncate("systemd-alert/"+h.ID()+"/"+u.Label, 512)
+}
+
+// Priority maps the severity of a unit to an opsgenie priority, P1 being the
+// highest. unknown severities rank between info and warning.
+func Priority(severity string) string {
+	switch severity {
+	case alerts.SeverityCritical:
+		return "P1"
+	case "error":
+		return "P2"
+	case alerts.SeverityWarning:
+		return "P3"
+	case alerts.SeverityInfo:
+		return "P5"
+	default:
+		return "P4"
+	}
+}
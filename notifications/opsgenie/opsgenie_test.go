@@ -0,0 +1,89 @@
+package opsgenie_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/opsgenie"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+var unit = &systemd.UnitStatus{
+	Name:        "nginx.service",
+	ActiveState: "failed",
+	SubState:    "failed",
+	Host:        &systemd.Host{Hostname: "web1", MachineID: "abc123", Labels: map[string]string{"team": "platform"}},
+	Settings:    &systemd.AlertSettings{Owner: "platform"},
+}
+
+func TestCreateAndClose(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusAccepted)
+	a := opsgenie.NewAlerter()
+	notifytest.Decode(t, a, `
+api_key = "k3y"
+url = "`+srv.URL+`/"
+tags = ["systemd"]
+`)
+
+	if err := a.Deliver(unit); err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]interface{}
+	r := <-requests
+	r.Decode(t, &body)
+	if r.URL.RequestURI() != "/v2/alerts" || r.Header.Get("Authorization") != "GenieKey k3y" {
+		t.Fatalf("unexpected request %s %s", r.URL, r.Header.Get("Authorization"))
+	}
+
+	if body["alias"] != "systemd-alert/abc123/nginx.service" || body["priority"] != "P1" || body["entity"] != "web1" {
+		t.Fatalf("unexpected alert %v", body)
+	}
+
+	if tags, _ := json.Marshal(body["tags"]); string(tags) != `["systemd","team:platform"]` {
+		t.Errorf("unexpected tags %s", tags)
+	}
+
+	if details, _ := body["details"].(map[string]interface{}); details["owner"] != "platform" || details["sub_state"] != "failed" {
+		t.Errorf("unexpected details %v", body["details"])
+	}
+
+	a.Resolve(unit)
+
+	if r = <-requests; r.URL.RequestURI() != "/v2/alerts/systemd-alert%2Fabc123%2Fnginx.service/close?identifierType=alias" {
+		t.Fatalf("unexpected close request %s", r.URL.RequestURI())
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, _ := notifytest.Serve(t, http.StatusUnauthorized)
+	a := opsgenie.NewAlerter()
+	notifytest.Decode(t, a, `
+api_key = "k3y"
+url = "`+srv.URL+`"
+`)
+
+	if err := a.Deliver(unit); err == nil {
+		t.Fatal("expected a rejected alert to fail")
+	}
+
+	if err := a.DeliverResolve(unit); err == nil {
+		t.Fatal("expected a rejected close to fail")
+	}
+}
+
+func TestPriority(t *testing.T) {
+	for s, expected := range map[string]string{
+		"critical": "P1",
+		"error":    "P2",
+		"warning":  "P3",
+		"major":    "P4",
+		"info":     "P5",
+	} {
+		if actual := opsgenie.Priority(s); actual != expected {
+			t.Errorf("expected %s to map to %s, got %s", s, expected, actual)
+		}
+	}
+}
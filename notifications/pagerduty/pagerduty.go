@@ -0,0 +1,303 @@
+package pagerduty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("pagerduty", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// DefaultURL of the events v2 api.
+const DefaultURL = "https://events.pagerduty.com/v2/enqueue"
+
+// event actions.
+const (
+	actionTrigger = "trigger"
+	actionResolve = "resolve"
+)
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		URL:     DefaultURL,
+		Timeout: 10 * time.Second,
+	}
+}
+
+// Alerter - triggers a pagerduty incident per unit using the events v2 api
+// and resolves it when the unit recovers.
+type Alerter struct {
+	RoutingKey string // integration key of the service
+	URL        string // events api, defaults to DefaultURL
+	Source     string // defaults to the hostname of the unit
+	Component  string
+	Group      string
+	Class      string
+	Timeout    time.Duration
+	client     *http.Client
+}
+
+// UnmarshalTOML decodes the pagerduty configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlPagerduty struct {
+		RoutingKey string
+		URL        string
+		Source     string
+		Component  string
+		Group      string
+		Class      string
+		Timeout    string
+	}
+
+	var (
+		err error
+		dec tomlPagerduty
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid pagerduty timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	if dec.URL != "" {
+		t.URL = dec.URL
+	}
+
+	t.RoutingKey = dec.RoutingKey
+	t.Source = dec.Source
+	t.Component = dec.Component
+	t.Group = dec.Group
+	t.Class = dec.Class
+
+	return nil
+}
+
+// Validate the routing key and api are configured.
+func (t *Alerter) Validate() error {
+	if t.RoutingKey == "" {
+		return errors.New("pagerduty requires a routing_key")
+	}
+
+	if u, err := url.Parse(t.URL); err != nil || u.Host == "" {
+		return errors.Errorf("invalid pagerduty url %q", t.URL)
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve the incidents of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver a trigger event for each of the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+type link struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+type payload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *payload `json:"payload,omitempty"`
+	Links       []link   `json:"links,omitempty"`
+}
+
+// send an event per unit, a failed event does not prevent the remaining
+// events from being sent.
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		failed int
+	)
+
+	for _, u := range b.Units {
+		if cause := t.post(t.event(b, u)); cause != nil {
+			failed++
+			err = cause
+		}
+	}
+
+	if failed > 0 {
+		return errors.Wrapf(err, "failed to send %d of %d pagerduty events", failed, len(b.Units))
+	}
+
+	return nil
+}
+
+func (t *Alerter) event(b message.Batch, u message.Unit) event {
+	e := event{
+		RoutingKey:  t.RoutingKey,
+		EventAction: actionTrigger,
+		DedupKey:    DedupKey(b.Host, u),
+	}
+
+	// resolve events only require the dedup key.
+	if b.Resolved {
+		e.EventAction = actionResolve
+		return e
+	}
+
+	source := t.Source
+	if source == "" {
+		source = hostname(b.Host)
+	}
+
+	details := map[string]string{
+		"unit":         u.Label,
+		"load_state":   u.LoadState,
+		"active_state": u.ActiveState,
+		"sub_state":    u.SubState,
+		"result":       u.Result,
+		"severity":     u.Severity,
+		"owner":        u.Owner,
+		"route":        u.Route,
+		"runbook":      u.Runbook,
+		"hostname":     b.Host.Hostname,
+		"machine_id":   b.Host.MachineID,
+		"boot_id":      b.Host.BootID,
+	}
+
+	for k, v := range b.Host.Labels {
+		details["label."+k] = v
+	}
+
+	for k, v := range details {
+		if v == "" {
+			delete(details, k)
+		}
+	}
+
+	e.Payload = &payload{
+		Summary:       message.Truncate(fmt.Sprintf("%s %s on %s (%s)", u.Label, u.ActiveState, source, u.SubState), 1024),
+		Source:        source,
+		Severity:      Severity(u),
+		Component:     t.Component,
+		Group:         t.Group,
+		Class:         t.Class,
+		CustomDetails: details,
+	}
+
+	if t.Component == "" {
+		e.Payload.Component = u.Name
+	}
+
+	if u.Runbook != "" {
+		e.Links = []link{{Href: u.Runbook, Text: "runbook"}}
+	}
+
+	return e
+}
+
+func (t *Alerter) post(e event) (err error) {
+	var (
+		raw  []byte
+		resp *http.Response
+	)
+
+	if raw, err = json.Marshal(e); err != nil {
+		return errors.Wrap(err, "failed to encode pagerduty event")
+	}
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Post(t.URL, "application/json", bytes.NewReader(raw)); err != nil {
+		return errors.Wrap(err, "failed to send pagerduty event")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("pagerduty event failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+// DedupKey identifies the incident of a unit on a host.
+func DedupKey(h message.Host, u message.Unit) string {
+	return "systemd-alert/" + h.ID() + "/" + u.Label
+}
+
+// Severity maps a unit to a severity pagerduty accepts: critical, error,
+// warning or info. the severity of the unit takes precedence, units without
+// one are critical if they timed out or dumped core and errors otherwise.
+// unknown severities are errors.
+func Severity(u message.Unit) string {
+	switch u.Severity {
+	case alerts.SeverityCritical, alerts.SeverityWarning, alerts.SeverityInfo, "error":
+		return u.Severity
+	case "":
+	default:
+		return "error"
+	}
+
+	switch u.Result {
+	case "timeout", "core-dump":
+		return alerts.SeverityCritical
+	default:
+		return "error"
+	}
+}
+
+func hostname(h message.Host) string {
+	if name := h.Name(); name != "" {
+		return name
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,147 @@
+package pagerduty_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/notifications/pagerduty"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+type event struct {
+	RoutingKey  string `json:"routing_key"`
+	EventAction string `json:"event_action"`
+	DedupKey    string `json:"dedup_key"`
+	Payload     *struct {
+		Summary       string            `json:"summary"`
+		Source        string            `json:"source"`
+		Severity      string            `json:"severity"`
+		Component     string            `json:"component"`
+		CustomDetails map[string]string `json:"custom_details"`
+	} `json:"payload"`
+	Links []struct {
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+func next(t *testing.T, requests <-chan notifytest.Request) (e event) {
+	r := <-requests
+	r.Decode(t, &e)
+	return e
+}
+
+var (
+	host   = &systemd.Host{Hostname: "web1", MachineID: "abc123", Labels: map[string]string{"team": "platform"}}
+	failed = &systemd.UnitStatus{
+		Name:        "nginx.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Host:        host,
+		Settings:    &systemd.AlertSettings{Runbook: "https://wiki.example.com/nginx"},
+	}
+	restarting = &systemd.UnitStatus{
+		Name:        "worker.service",
+		ActiveState: "activating",
+		SubState:    "auto-restart",
+		Result:      "exit-code",
+		NRestarts:   2,
+		Host:        host,
+	}
+)
+
+func TestTriggerAndResolve(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusAccepted)
+	a := pagerduty.NewAlerter()
+	notifytest.Decode(t, a, `
+routing_key = "r0uting"
+url = "`+srv.URL+`"
+`)
+
+	if err := a.Deliver(failed, restarting); err != nil {
+		t.Fatal(err)
+	}
+
+	e := next(t, requests)
+	if e.RoutingKey != "r0uting" || e.EventAction != "trigger" || e.DedupKey != "systemd-alert/abc123/nginx.service" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	if e.Payload == nil || e.Payload.Severity != "critical" || e.Payload.Source != "web1" || e.Payload.Component != "nginx.service" {
+		t.Fatalf("unexpected payload %+v", e.Payload)
+	}
+
+	if e.Payload.CustomDetails["label.team"] != "platform" || e.Payload.CustomDetails["sub_state"] != "failed" {
+		t.Errorf("unexpected details %v", e.Payload.CustomDetails)
+	}
+
+	if len(e.Links) != 1 || e.Links[0].Href != "https://wiki.example.com/nginx" {
+		t.Errorf("unexpected links %+v", e.Links)
+	}
+
+	if e = next(t, requests); e.DedupKey != "systemd-alert/abc123/worker.service" || e.Payload.Severity != "warning" || e.Payload.CustomDetails["result"] != "exit-code" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	a.Resolve(failed)
+
+	if e = next(t, requests); e.EventAction != "resolve" || e.DedupKey != "systemd-alert/abc123/nginx.service" || e.Payload != nil {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, _ := notifytest.Serve(t, http.StatusBadRequest)
+	a := pagerduty.NewAlerter()
+	notifytest.Decode(t, a, `
+routing_key = "r0uting"
+url = "`+srv.URL+`"
+`)
+
+	if err := a.Deliver(failed); err == nil {
+		t.Fatal("expected a rejected event to fail")
+	}
+
+	if err := a.DeliverResolve(failed); err == nil {
+		t.Fatal("expected a rejected resolve to fail")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	for s, expected := range map[string]string{
+		"critical": "critical",
+		"error":    "error",
+		"warning":  "warning",
+		"info":     "info",
+		"major":    "error",
+	} {
+		if actual := pagerduty.Severity(message.Unit{Severity: s}); actual != expected {
+			t.Errorf("expected %s to map to %s, got %s", s, expected, actual)
+		}
+	}
+
+	// the severity of the unit takes precedence over its service result.
+	for result, expected := range map[string]string{
+		"timeout":   "warning",
+		"core-dump": "warning",
+		"exit-code": "warning",
+		"":          "warning",
+	} {
+		if actual := pagerduty.Severity(message.Unit{Severity: "warning", Result: result}); actual != expected {
+			t.Errorf("expected result %q of a warning to map to %s, got %s", result, expected, actual)
+		}
+	}
+
+	for result, expected := range map[string]string{
+		"timeout":   "critical",
+		"core-dump": "critical",
+		"exit-code": "error",
+		"signal":    "error",
+		"":          "error",
+	} {
+		if actual := pagerduty.Severity(message.Unit{Result: result}); actual != expected {
+			t.Errorf("expected result %q to map to %s, got %s", result, expected, actual)
+		}
+	}
+}
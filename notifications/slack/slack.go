@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/james-lawrence/systemd-alert"
@@ -55,10 +57,29 @@ type Alerter struct {
 	client  *http.Client
 }
 
+// Validate the webhook is configured.
+func (t Alerter) Validate() error {
+	if t.Webhook == "" {
+		return errors.New("slack webhook is required")
+	}
+
+	if u, err := url.Parse(t.Webhook); err != nil || u.Host == "" {
+		return errors.Errorf("invalid slack webhook %q", t.Webhook)
+	}
+
+	return nil
+}
+
 // Alert about the provided units.
 func (t Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Deliver the provided units to the webhook.
+func (t Alerter) Deliver(units ...*systemd.UnitStatus) (err error) {
 	var (
-		err  error
 		raw  []byte
 		resp *http.Response
 	)
@@ -68,8 +89,12 @@ func (t Alerter) Alert(units ...*systemd.UnitStatus) {
 	}
 
 	fields := make([]field, 0, len(units))
+	if len(units) > 0 {
+		fields = append(fields, hostFields(units[0].Host)...)
+	}
+
 	for _, unit := range units {
-		fields = append(fields, field{Title: unit.Name, Value: fmt.Sprintf("%s - %s", unit.ActiveState, unit.SubState), Short: false})
+		fields = append(fields, field{Title: unit.Label(), Value: describe(unit), Short: false})
 	}
 
 	msg := os.ExpandEnv(t.Message)
@@ -81,16 +106,66 @@ func (t Alerter) Alert(units ...*systemd.UnitStatus) {
 	}
 
 	if raw, err = json.Marshal(n); err != nil {
-		log.Println(errors.Wrap(err, "failed to encode slack notification"))
-		return
+		return errors.Wrap(err, "failed to encode slack notification")
 	}
 
 	if resp, err = http.Post(t.Webhook, "application/json", bytes.NewReader(raw)); err != nil {
-		log.Println(errors.Wrap(err, "failed to post webhook"))
-		return
+		return errors.Wrap(err, "failed to post webhook")
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode > 299 {
-		log.Println("webhook request failed with status code", resp.StatusCode)
+		return errors.Errorf("webhook request failed with status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// describe the state of the unit and the settings declared by its owner.
+func describe(unit *systemd.UnitStatus) string {
+	value := fmt.Sprintf("%s - %s (%s)", unit.ActiveState, unit.SubState, alerts.Severity(unit))
+	if unit.Settings == nil {
+		return value
+	}
+
+	if unit.Settings.Owner != "" {
+		value += "\nowner: " + unit.Settings.Owner
 	}
+
+	if unit.Settings.Runbook != "" {
+		value += "\nrunbook: " + unit.Settings.Runbook
+	}
+
+	return value
+}
+
+// hostFields describe the host the batch was observed on.
+func hostFields(h *systemd.Host) (fields []field) {
+	if h == nil {
+		return fields
+	}
+
+	if h.Hostname != "" {
+		fields = append(fields, field{Title: "host", Value: h.Hostname, Short: true})
+	}
+
+	if h.MachineID != "" {
+		fields = append(fields, field{Title: "machine-id", Value: h.MachineID, Short: true})
+	}
+
+	if h.BootID != "" {
+		fields = append(fields, field{Title: "boot-id", Value: h.BootID, Short: true})
+	}
+
+	keys := make([]string, 0, len(h.Labels))
+	for k := range h.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fields = append(fields, field{Title: k, Value: h.Labels[k], Short: true})
+	}
+
+	return fields
 }
@@ -0,0 +1,274 @@
+package teams
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("teams", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Timeout: 10 * time.Second,
+	}
+}
+
+// Alerter - posts an adaptive card per batch to a microsoft teams incoming
+// webhook or workflows url.
+type Alerter struct {
+	Webhook string
+	Title   string // defaults to the status and host of the batch
+	Runbook string // linked from every card, in addition to unit runbooks
+	Timeout time.Duration
+	client  *http.Client
+}
+
+// UnmarshalTOML decodes the teams configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlTeams struct {
+		Webhook string
+		Title   string
+		Runbook string
+		Timeout string
+	}
+
+	var (
+		err error
+		dec tomlTeams
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid teams timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	t.Webhook = dec.Webhook
+	t.Title = dec.Title
+	t.Runbook = dec.Runbook
+
+	return nil
+}
+
+// Validate the webhook is configured.
+func (t *Alerter) Validate() error {
+	if u, err := url.Parse(t.Webhook); err != nil || u.Host == "" {
+		return errors.Errorf("invalid teams webhook %q", t.Webhook)
+	}
+
+	if t.Runbook != "" {
+		if u, err := url.Parse(t.Runbook); err != nil || u.Host == "" {
+			return errors.Errorf("invalid teams runbook %q", t.Runbook)
+		}
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve posts a card about the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver a card about the provided units.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+type element map[string]interface{}
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type attachment struct {
+	ContentType string  `json:"contentType"`
+	ContentURL  *string `json:"contentUrl"`
+	Content     element `json:"content"`
+}
+
+type payload struct {
+	Type        string       `json:"type"`
+	Attachments []attachment `json:"attachments"`
+}
+
+// card renders the batch as an adaptive card.
+func (t *Alerter) card(b message.Batch) element {
+	var (
+		body    []element
+		actions []element
+		seen    = map[string]bool{}
+	)
+
+	host := b.Host.Name()
+
+	title := t.Title
+	if title == "" {
+		title = fmt.Sprintf("%s: %d units on %s", b.Status, len(b.Units), host)
+	}
+
+	body = append(body, element{
+		"type":   "TextBlock",
+		"text":   title,
+		"size":   "Large",
+		"weight": "Bolder",
+		"color":  Color(b.Severity, b.Resolved),
+		"wrap":   true,
+	})
+
+	for _, u := range b.Units {
+		facts := []fact{
+			{Title: "State", Value: u.ActiveState},
+			{Title: "Sub State", Value: u.SubState},
+			{Title: "Severity", Value: u.Severity},
+			{Title: "Host", Value: host},
+		}
+
+		if u.Result != "" {
+			facts = append(facts, fact{Title: "Result", Value: u.Result})
+		}
+
+		if u.Restarts > 0 {
+			facts = append(facts, fact{Title: "Restarts", Value: strconv.FormatUint(uint64(u.Restarts), 10)})
+		}
+
+		if u.Owner != "" {
+			facts = append(facts, fact{Title: "Owner", Value: u.Owner})
+		}
+
+		body = append(body, element{
+			"type":  "Container",
+			"style": Style(u.Severity, b.Resolved),
+			"bleed": true,
+			"items": []element{
+				{"type": "TextBlock", "text": u.Label, "weight": "Bolder", "wrap": true},
+				{"type": "FactSet", "facts": facts},
+			},
+		})
+
+		if u.Runbook != "" && !seen[u.Runbook] {
+			seen[u.Runbook] = true
+			actions = append(actions, element{"type": "Action.OpenUrl", "title": "Runbook: " + u.Label, "url": u.Runbook})
+		}
+	}
+
+	if t.Runbook != "" && !seen[t.Runbook] {
+		actions = append(actions, element{"type": "Action.OpenUrl", "title": "Runbook", "url": t.Runbook})
+	}
+
+	card := element{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+		"msteams": element{"width": "Full"},
+	}
+
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+
+	return card
+}
+
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		raw  []byte
+		resp *http.Response
+	)
+
+	p := payload{
+		Type: "message",
+		Attachments: []attachment{
+			{ContentType: "application/vnd.microsoft.card.adaptive", Content: t.card(b)},
+		},
+	}
+
+	if raw, err = json.Marshal(p); err != nil {
+		return errors.Wrap(err, "failed to encode teams card")
+	}
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Post(t.Webhook, "application/json", bytes.NewReader(raw)); err != nil {
+		return errors.Wrap(err, "failed to send teams card")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("teams webhook failed with status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+// Color of the card's title for the severity, resolved batches are good.
+func Color(severity string, resolved bool) string {
+	switch {
+	case resolved:
+		return "Good"
+	case severity == alerts.SeverityCritical:
+		return "Attention"
+	case severity == alerts.SeverityInfo:
+		return "Accent"
+	default:
+		return "Warning"
+	}
+}
+
+// Style of a unit's container for the severity, resolved units are good.
+func Style(severity string, resolved bool) string {
+	switch {
+	case resolved:
+		return "good"
+	case severity == alerts.SeverityCritical:
+		return "attention"
+	case severity == alerts.SeverityInfo:
+		return "accent"
+	default:
+		return "warning"
+	}
+}
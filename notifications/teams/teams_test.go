@@ -0,0 +1,136 @@
+package teams_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/teams"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+type card struct {
+	Type string `json:"type"`
+	Body []struct {
+		Type  string `json:"type"`
+		Text  string `json:"text"`
+		Color string `json:"color"`
+		Style string `json:"style"`
+		Items []struct {
+			Type  string `json:"type"`
+			Text  string `json:"text"`
+			Facts []struct {
+				Title string `json:"title"`
+				Value string `json:"value"`
+			} `json:"facts"`
+		} `json:"items"`
+	} `json:"body"`
+	Actions []struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	} `json:"actions"`
+}
+
+type payload struct {
+	Type        string `json:"type"`
+	Attachments []struct {
+		ContentType string `json:"contentType"`
+		Content     card   `json:"content"`
+	} `json:"attachments"`
+}
+
+func next(t *testing.T, requests <-chan notifytest.Request) (p payload) {
+	r := <-requests
+	r.Decode(t, &p)
+	return p
+}
+
+var (
+	host   = &systemd.Host{Hostname: "web1"}
+	failed = &systemd.UnitStatus{
+		Name:        "nginx.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Host:        host,
+		Settings:    &systemd.AlertSettings{Runbook: "https://wiki.example.com/nginx"},
+	}
+	restarting = &systemd.UnitStatus{
+		Name:        "worker.service",
+		ActiveState: "activating",
+		SubState:    "auto-restart",
+		Result:      "exit-code",
+		NRestarts:   4,
+		Host:        host,
+	}
+)
+
+func TestDeliver(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusAccepted)
+	a := teams.NewAlerter()
+	notifytest.Decode(t, a, `
+webhook = "`+srv.URL+`"
+runbook = "https://wiki.example.com/oncall"
+`)
+
+	if err := a.Deliver(failed, restarting); err != nil {
+		t.Fatal(err)
+	}
+
+	p := next(t, requests)
+	if p.Type != "message" || len(p.Attachments) != 1 || p.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+
+	c := p.Attachments[0].Content
+	if c.Type != "AdaptiveCard" || len(c.Body) != 3 {
+		t.Fatalf("expected a title and a container per unit, got %+v", c.Body)
+	}
+
+	if c.Body[0].Text != "firing: 2 units on web1" || c.Body[0].Color != "Attention" {
+		t.Errorf("unexpected title %+v", c.Body[0])
+	}
+
+	if c.Body[1].Style != "attention" || c.Body[1].Items[0].Text != "nginx.service" {
+		t.Errorf("unexpected container %+v", c.Body[1])
+	}
+
+	if c.Body[2].Style != "warning" || c.Body[2].Items[1].Facts[1].Value != "auto-restart" || c.Body[2].Items[1].Facts[3].Value != "web1" {
+		t.Errorf("unexpected container %+v", c.Body[2])
+	}
+
+	facts := c.Body[2].Items[1].Facts
+	if len(facts) != 6 || facts[4].Title != "Result" || facts[4].Value != "exit-code" || facts[5].Title != "Restarts" || facts[5].Value != "4" {
+		t.Errorf("expected the service result and restarts, got %+v", facts)
+	}
+
+	if facts = c.Body[1].Items[1].Facts; len(facts) != 4 || facts[1].Title != "Sub State" {
+		t.Errorf("unexpected facts %+v", facts)
+	}
+
+	if len(c.Actions) != 2 || c.Actions[0].URL != "https://wiki.example.com/nginx" || c.Actions[1].URL != "https://wiki.example.com/oncall" {
+		t.Errorf("unexpected actions %+v", c.Actions)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusOK)
+	a := teams.NewAlerter()
+	notifytest.Decode(t, a, `webhook = "`+srv.URL+`"`)
+
+	a.Resolve(failed)
+
+	c := next(t, requests).Attachments[0].Content
+	if c.Body[0].Color != "Good" || c.Body[1].Style != "good" {
+		t.Errorf("expected a resolved card to be good, got %+v", c.Body)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, _ := notifytest.Serve(t, http.StatusBadRequest)
+	a := teams.NewAlerter()
+	notifytest.Decode(t, a, `webhook = "`+srv.URL+`"`)
+
+	if err := a.Deliver(failed); err == nil {
+		t.Fatal("expected a rejected card to fail")
+	}
+}
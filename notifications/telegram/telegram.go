@@ -0,0 +1,282 @@
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("telegram", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// DefaultURL of the bot api.
+const DefaultURL = "https://api.telegram.org"
+
+// telegram rejects messages longer than 4096 characters.
+const maxMessage = 4096
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		URL:         DefaultURL,
+		SilentBelow: alerts.SeverityWarning,
+		Timeout:     10 * time.Second,
+	}
+}
+
+// Alerter - sends a message per batch to telegram chats using the bot api.
+type Alerter struct {
+	Token       string   // bot token
+	URL         string   // bot api base url, defaults to DefaultURL
+	ChatIDs     []string // chat ids or @channel usernames
+	SilentBelow string   // batches below this severity are delivered silently
+	Timeout     time.Duration
+	client      *http.Client
+}
+
+// UnmarshalTOML decodes the telegram configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlTelegram struct {
+		Token       string
+		URL         string
+		ChatIDs     []string
+		SilentBelow string
+		Timeout     string
+	}
+
+	var (
+		err error
+		dec tomlTelegram
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return errors.Errorf("invalid telegram timeout %q: %v", dec.Timeout, err)
+		}
+	}
+
+	if dec.URL != "" {
+		t.URL = strings.TrimSuffix(dec.URL, "/")
+	}
+
+	if dec.SilentBelow != "" {
+		t.SilentBelow = strings.ToLower(dec.SilentBelow)
+	}
+
+	t.Token = dec.Token
+	t.ChatIDs = dec.ChatIDs
+
+	return nil
+}
+
+// Validate the token and chats are configured.
+func (t *Alerter) Validate() error {
+	if t.Token == "" {
+		return errors.New("telegram requires a bot token")
+	}
+
+	if u, err := url.Parse(t.URL); err != nil || u.Host == "" {
+		return errors.Errorf("invalid telegram url %q", t.URL)
+	}
+
+	if len(t.ChatIDs) == 0 {
+		return errors.New("telegram requires at least one chat id")
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve sends a message about the recovery of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver a message about the provided units to every chat.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+type request struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableNotification   bool   `json:"disable_notification"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type response struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// send the batch to every chat, a failed chat does not prevent delivery to
+// the remaining chats.
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		failed int
+	)
+
+	text := Text(b)
+	// recoveries never need to wake anyone up.
+	silent := b.Resolved || message.Rank(b.Severity) < message.Rank(t.SilentBelow)
+
+	for _, chat := range t.ChatIDs {
+		req := request{
+			ChatID:                chat,
+			Text:                  text,
+			ParseMode:             "MarkdownV2",
+			DisableNotification:   silent,
+			DisableWebPagePreview: true,
+		}
+
+		if cause := t.post(req); cause != nil {
+			failed++
+			err = errors.Wrapf(cause, "chat %s", chat)
+		}
+	}
+
+	if failed > 0 {
+		return errors.Wrapf(err, "failed to send %d of %d telegram messages", failed, len(t.ChatIDs))
+	}
+
+	return nil
+}
+
+func (t *Alerter) post(req request) (err error) {
+	var (
+		raw     []byte
+		resp    *http.Response
+		decoded response
+	)
+
+	if raw, err = json.Marshal(req); err != nil {
+		return errors.Wrap(err, "failed to encode telegram message")
+	}
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Post(t.URL+"/bot"+t.Token+"/sendMessage", "application/json", bytes.NewReader(raw)); err != nil {
+		// the url contains the bot token, never log it.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+
+		return errors.Wrap(err, "failed to send telegram message")
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err = json.Unmarshal(body, &decoded); err != nil || !decoded.OK {
+		if decoded.Description == "" {
+			decoded.Description = string(bytes.TrimSpace(body))
+		}
+
+		return errors.Errorf("telegram request failed with status code %d: %s", resp.StatusCode, decoded.Description)
+	}
+
+	return nil
+}
+
+// Text renders the batch as MarkdownV2.
+func Text(b message.Batch) string {
+	var (
+		buf strings.Builder
+	)
+
+	host := b.Host.Name()
+
+	fmt.Fprintf(&buf, "*%s*: %d units on *%s*\n", Escape(b.Status), len(b.Units), Escape(host))
+	for i, u := range b.Units {
+		var (
+			line strings.Builder
+		)
+
+		fmt.Fprintf(&line, "`%s`: %s", EscapeCode(u.Label), Escape(fmt.Sprintf("%s - %s (%s)", u.ActiveState, u.SubState, u.Severity)))
+
+		if u.Owner != "" {
+			fmt.Fprintf(&line, " owner: %s", Escape(u.Owner))
+		}
+
+		if u.Runbook != "" {
+			fmt.Fprintf(&line, " [runbook](%s)", EscapeLink(u.Runbook))
+		}
+
+		line.WriteString("\n")
+
+		// drop whole lines so no entity is cut in half, leaving room for the
+		// summary of the dropped units.
+		if len([]rune(buf.String()))+len([]rune(line.String())) > maxMessage-64 {
+			buf.WriteString(Escape(fmt.Sprintf("... and %d more", len(b.Units)-i)))
+			break
+		}
+
+		buf.WriteString(line.String())
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+var (
+	escaper     = strings.NewReplacer(specials("_*[]()~`>#+-=|{}.!\\")...)
+	codeEscaper = strings.NewReplacer(specials("`\\")...)
+	linkEscaper = strings.NewReplacer(specials(")\\")...)
+)
+
+func specials(chars string) (pairs []string) {
+	for _, c := range chars {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+
+	return pairs
+}
+
+// Escape text for MarkdownV2.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// EscapeCode escapes text inside of a MarkdownV2 code entity.
+func EscapeCode(s string) string {
+	return codeEscaper.Replace(s)
+}
+
+// EscapeLink escapes the url of a MarkdownV2 inline link.
+func EscapeLink(s string) string {
+	return linkEscaper.Replace(s)
+}
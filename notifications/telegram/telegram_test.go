@@ -0,0 +1,147 @@
+package telegram_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/notifications/telegram"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+type request struct {
+	path                string
+	ChatID              string `json:"chat_id"`
+	Text                string `json:"text"`
+	ParseMode           string `json:"parse_mode"`
+	DisableNotification bool   `json:"disable_notification"`
+}
+
+func next(t *testing.T, requests <-chan notifytest.Request) (req request) {
+	r := <-requests
+	r.Decode(t, &req)
+	req.path = r.URL.Path
+	return req
+}
+
+// reject messages to the chat named "broken".
+func reject(t *testing.T) func(int, notifytest.Request) notifytest.Response {
+	return func(n int, r notifytest.Request) notifytest.Response {
+		var req request
+		if r.Decode(t, &req); req.ChatID == "broken" {
+			return notifytest.Response{Status: http.StatusBadRequest, Body: `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`}
+		}
+
+		return notifytest.Response{Status: http.StatusOK, Body: `{"ok": true, "result": {}}`}
+	}
+}
+
+var (
+	host   = &systemd.Host{Hostname: "web-1.example.com"}
+	failed = &systemd.UnitStatus{
+		Name:        "nginx.service",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Host:        host,
+		Settings:    &systemd.AlertSettings{Runbook: "https://wiki.example.com/nginx_(web)"},
+	}
+	info = &systemd.UnitStatus{
+		Name:        "backup.service",
+		ActiveState: "inactive",
+		SubState:    "dead",
+		Host:        host,
+	}
+)
+
+func TestDeliver(t *testing.T) {
+	srv, requests := notifytest.Handle(t, reject(t))
+	a := telegram.NewAlerter()
+	notifytest.Decode(t, a, `
+token = "123:abc"
+url = "`+srv.URL+`/"
+chat_ids = ["-1001234", "@ops"]
+`)
+
+	if err := a.Deliver(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chat := range []string{"-1001234", "@ops"} {
+		r := next(t, requests)
+		if r.path != "/bot123:abc/sendMessage" || r.ChatID != chat || r.ParseMode != "MarkdownV2" || r.DisableNotification {
+			t.Fatalf("unexpected request %+v", r)
+		}
+
+		if !strings.Contains(r.Text, "*firing*: 1 units on *web\\-1\\.example\\.com*") || !strings.Contains(r.Text, "[runbook](https://wiki.example.com/nginx_(web\\))") {
+			t.Errorf("unexpected text %q", r.Text)
+		}
+	}
+}
+
+func TestDeliverSilently(t *testing.T) {
+	srv, requests := notifytest.Handle(t, reject(t))
+	a := telegram.NewAlerter()
+	notifytest.Decode(t, a, `
+token = "123:abc"
+url = "`+srv.URL+`"
+chat_ids = ["-1001234"]
+`)
+
+	if err := a.Deliver(info); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := next(t, requests); !r.DisableNotification {
+		t.Error("expected info to be delivered silently")
+	}
+
+	a.Resolve(failed)
+
+	if r := next(t, requests); !r.DisableNotification {
+		t.Error("expected recoveries to be delivered silently")
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, requests := notifytest.Handle(t, reject(t))
+	a := telegram.NewAlerter()
+	notifytest.Decode(t, a, `
+token = "123:abc"
+url = "`+srv.URL+`"
+chat_ids = ["broken", "@ops"]
+`)
+
+	err := a.Deliver(failed)
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Fatalf("expected a rejected message to fail, got %v", err)
+	}
+
+	if next(t, requests); next(t, requests).ChatID != "@ops" {
+		t.Error("expected the remaining chats to receive the message")
+	}
+}
+
+func TestText(t *testing.T) {
+	units := make([]*systemd.UnitStatus, 0, 200)
+	for i := 0; i < 200; i++ {
+		units = append(units, &systemd.UnitStatus{Name: fmt.Sprintf("worker-with-a-long-name@%03d.service", i), ActiveState: "failed", SubState: "failed", Host: host})
+	}
+
+	text := telegram.Text(message.New(false, units...))
+	if n := len([]rune(text)); n > 4096 {
+		t.Fatalf("expected the text to respect the message limit, got %d characters", n)
+	}
+
+	if !strings.HasSuffix(text, "more") {
+		t.Errorf("expected a summary of the dropped units, got %q", text[len(text)-64:])
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if escaped := telegram.Escape(`a_b*c[d]e(f)g~h` + "`" + `i>j#k+l-m=n|o{p}q.r!s\t`); escaped != `a\_b\*c\[d\]e\(f\)g\~h\`+"`"+`i\>j\#k\+l\-m\=n\|o\{p\}q\.r\!s\\t` {
+		t.Errorf("unexpected escape %q", escaped)
+	}
+}
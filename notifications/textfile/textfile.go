@@ -0,0 +1,317 @@
+package textfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("textfile", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Directory: "/var/lib/node_exporter/textfile_collector",
+		Name:      "systemd-alert.prom",
+		Refresh:   time.Minute,
+		m:         &sync.Mutex{},
+		once:      &sync.Once{},
+		stop:      &sync.Once{},
+		done:      make(chan struct{}),
+		units:     make(map[string]*unitMetrics),
+	}
+}
+
+type unitMetrics struct {
+	name        string
+	source      string
+	failed      bool
+	restarts    uint64
+	nrestarts   uint32 // systemd's restart count when the unit was last observed
+	lastFailure time.Time
+}
+
+// Alerter - writes unit metrics for the node_exporter textfile collector.
+type Alerter struct {
+	Directory string
+	Name      string
+	Refresh   time.Duration
+	m         *sync.Mutex
+	once      *sync.Once
+	stop      *sync.Once
+	done      chan struct{}
+	units     map[string]*unitMetrics
+}
+
+// UnmarshalTOML decodes the textfile configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlTextfile struct {
+		Directory string
+		Name      string
+		Refresh   string
+	}
+
+	var (
+		err     error
+		dec     tomlTextfile
+		refresh time.Duration
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Refresh != "" {
+		if refresh, err = time.ParseDuration(dec.Refresh); err != nil {
+			return errors.Errorf("invalid textfile refresh %q: %v", dec.Refresh, err)
+		}
+		t.Refresh = refresh
+	}
+
+	if dec.Directory != "" {
+		t.Directory = dec.Directory
+	}
+
+	if dec.Name != "" {
+		t.Name = dec.Name
+	}
+
+	return nil
+}
+
+// Start periodically rewrites the metrics file so the collector can detect
+// a stale agent.
+func (t *Alerter) Start() {
+	t.once.Do(func() {
+		t.flush()
+
+		if t.Refresh <= 0 {
+			return
+		}
+
+		go func() {
+			ticker := time.NewTicker(t.Refresh)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					t.flush()
+				case <-t.done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop refreshing the metrics file.
+func (t *Alerter) Stop() {
+	t.stop.Do(func() {
+		close(t.done)
+	})
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Deliver records the provided units and writes the metrics file.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.record(units...)
+
+	return errors.Wrap(t.write(t.render(time.Now())), "failed to write textfile metrics")
+}
+
+// record must be called while holding the lock.
+func (t *Alerter) record(units ...*systemd.UnitStatus) {
+	now := time.Now()
+
+	for _, unit := range units {
+		m := t.metrics(unit)
+		m.restarted(unit)
+
+		switch {
+		case alerts.FilterFailed(unit):
+			m.failed = true
+			m.lastFailure = now
+		case alerts.FilterAutorestart(unit):
+			m.lastFailure = now
+		}
+	}
+}
+
+// restarted counts the automatic restarts of the unit since it was last
+// observed using systemd's restart count, so restarts within a single batch
+// or cooldown are not lost. without a count, e.g. for replayed events, an
+// alerted restart counts once.
+func (t *unitMetrics) restarted(unit *systemd.UnitStatus) {
+	n := unit.NRestarts
+
+	switch {
+	case n == 0:
+		if alerts.FilterAutorestart(unit) {
+			t.restarts++
+		}
+	case n > t.nrestarts:
+		t.restarts += uint64(n - t.nrestarts)
+	case n < t.nrestarts:
+		// systemd resets the count when the unit is started explicitly.
+		t.restarts += uint64(n)
+	}
+
+	t.nrestarts = n
+}
+
+// Resolve clears the failed state of the provided units.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve clears the failed state of the provided units and writes
+// the metrics file.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, unit := range units {
+		m := t.metrics(unit)
+		m.restarted(unit)
+		m.failed = false
+	}
+
+	return errors.Wrap(t.write(t.render(time.Now())), "failed to write textfile metrics")
+}
+
+// metrics must be called while holding the lock.
+func (t *Alerter) metrics(unit *systemd.UnitStatus) *unitMetrics {
+	m, ok := t.units[unit.Label()]
+	if !ok {
+		m = &unitMetrics{name: unit.Name, source: unit.Source}
+		t.units[unit.Label()] = m
+	}
+	return m
+}
+
+func (t unitMetrics) labels() string {
+	if t.source == "" {
+		return fmt.Sprintf("unit=\"%s\"", escape(t.name))
+	}
+
+	return fmt.Sprintf("source=\"%s\",unit=\"%s\"", escape(t.source), escape(t.name))
+}
+
+func (t *Alerter) flush() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if err := t.write(t.render(time.Now())); err != nil {
+		log.Println(errors.Wrap(err, "failed to write textfile metrics"))
+	}
+}
+
+// render must be called while holding the lock.
+func (t *Alerter) render(now time.Time) []byte {
+	var (
+		b bytes.Buffer
+	)
+
+	names := make([]string, 0, len(t.units))
+	for name := range t.units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(&b, "# HELP systemd_alert_unit_failed Whether the unit is currently in the failed state.")
+	fmt.Fprintln(&b, "# TYPE systemd_alert_unit_failed gauge")
+	for _, name := range names {
+		fmt.Fprintf(&b, "systemd_alert_unit_failed{%s} %d\n", t.units[name].labels(), boolean(t.units[name].failed))
+	}
+
+	fmt.Fprintln(&b, "# HELP systemd_alert_unit_restarts_total Automatic restarts of the unit.")
+	fmt.Fprintln(&b, "# TYPE systemd_alert_unit_restarts_total counter")
+	for _, name := range names {
+		fmt.Fprintf(&b, "systemd_alert_unit_restarts_total{%s} %d\n", t.units[name].labels(), t.units[name].restarts)
+	}
+
+	fmt.Fprintln(&b, "# HELP systemd_alert_unit_last_failure_timestamp_seconds Time the unit last failed or was restarted.")
+	fmt.Fprintln(&b, "# TYPE systemd_alert_unit_last_failure_timestamp_seconds gauge")
+	for _, name := range names {
+		if t.units[name].lastFailure.IsZero() {
+			continue
+		}
+		fmt.Fprintf(&b, "systemd_alert_unit_last_failure_timestamp_seconds{%s} %d\n", t.units[name].labels(), t.units[name].lastFailure.Unix())
+	}
+
+	fmt.Fprintln(&b, "# HELP systemd_alert_last_refresh_timestamp_seconds Time the metrics were last written.")
+	fmt.Fprintln(&b, "# TYPE systemd_alert_last_refresh_timestamp_seconds gauge")
+	fmt.Fprintf(&b, "systemd_alert_last_refresh_timestamp_seconds %d\n", now.Unix())
+
+	return b.Bytes()
+}
+
+// write atomically replaces the metrics file so the collector never observes
+// a partially written file.
+func (t *Alerter) write(raw []byte) (err error) {
+	var (
+		tmp *os.File
+	)
+
+	if tmp, err = ioutil.TempFile(t.Directory, "."+t.Name); err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(t.Directory, t.Name))
+}
+
+func boolean(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,153 @@
+package textfile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/textfile"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+func decode(t *testing.T) (*textfile.Alerter, string) {
+	dir, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	a := textfile.NewAlerter()
+	notifytest.Decode(t, a, `
+directory = "`+dir+`"
+name = "units.prom"
+refresh = "0s"
+`)
+
+	return a, filepath.Join(dir, "units.prom")
+}
+
+// metrics reads the samples of the metrics file, keyed by metric and labels.
+func metrics(t *testing.T, path string) map[string]string {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.LastIndex(line, " ")
+		samples[line[:i]] = line[i+1:]
+	}
+
+	return samples
+}
+
+func restarting(n uint32) *systemd.UnitStatus {
+	return &systemd.UnitStatus{Name: "worker.service", Source: "web1", ActiveState: "activating", SubState: "auto-restart", NRestarts: n}
+}
+
+func TestDeliver(t *testing.T) {
+	a, path := decode(t)
+	failed := &systemd.UnitStatus{Name: "nginx.service", ActiveState: "failed", SubState: "failed"}
+
+	if err := a.Deliver(failed, restarting(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := metrics(t, path)
+	for sample, expected := range map[string]string{
+		`systemd_alert_unit_failed{unit="nginx.service"}`:                        "1",
+		`systemd_alert_unit_failed{source="web1",unit="worker.service"}`:         "0",
+		`systemd_alert_unit_restarts_total{unit="nginx.service"}`:                "0",
+		`systemd_alert_unit_restarts_total{source="web1",unit="worker.service"}`: "3",
+	} {
+		if samples[sample] != expected {
+			t.Errorf("expected %s %s, got %q", sample, expected, samples[sample])
+		}
+	}
+
+	for _, sample := range []string{
+		`systemd_alert_unit_last_failure_timestamp_seconds{unit="nginx.service"}`,
+		`systemd_alert_unit_last_failure_timestamp_seconds{source="web1",unit="worker.service"}`,
+		`systemd_alert_last_refresh_timestamp_seconds`,
+	} {
+		if _, ok := samples[sample]; !ok {
+			t.Errorf("expected a %s sample", sample)
+		}
+	}
+
+	a.Resolve(failed)
+
+	if v := metrics(t, path)[`systemd_alert_unit_failed{unit="nginx.service"}`]; v != "0" {
+		t.Errorf("expected the failed gauge to clear on resolve, got %q", v)
+	}
+}
+
+func TestDeliverCountsRestarts(t *testing.T) {
+	a, path := decode(t)
+	const sample = `systemd_alert_unit_restarts_total{source="web1",unit="worker.service"}`
+
+	for _, step := range []struct {
+		unit     *systemd.UnitStatus
+		expected string
+	}{
+		{restarting(2), "2"},
+		{restarting(5), "5"}, // restarts batched together are all counted.
+		{restarting(1), "6"}, // systemd reset its count.
+		{restarting(0), "7"}, // without a count every alert is a restart.
+	} {
+		if err := a.Deliver(step.unit); err != nil {
+			t.Fatal(err)
+		}
+
+		if v := metrics(t, path)[sample]; v != step.expected {
+			t.Fatalf("expected %s restarts after observing %d, got %q", step.expected, step.unit.NRestarts, v)
+		}
+	}
+}
+
+func TestWriteReplacesFile(t *testing.T) {
+	a, path := decode(t)
+
+	if err := a.Deliver(restarting(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = a.Deliver(restarting(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if os.SameFile(before, after) {
+		t.Error("expected the metrics file to be replaced rather than rewritten in place")
+	}
+
+	if after.Mode().Perm() != 0644 {
+		t.Errorf("expected the metrics file to be world readable, got %s", after.Mode())
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, got %d files", len(entries))
+	}
+}
@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/notifications"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	notifications.Add("webhook", func() alerts.Notifier {
+		return NewAlerter()
+	})
+}
+
+// NewAlerter configures the Alerter
+func NewAlerter() *Alerter {
+	return &Alerter{
+		Method:          http.MethodPost,
+		ContentType:     "application/json",
+		SignatureHeader: "X-Signature-256",
+		Timeout:         10 * time.Second,
+	}
+}
+
+// Alerter - sends batches to an arbitrary HTTP endpoint. the body is the JSON
+// encoded batch unless a template is provided, see the message package for
+// the fields available to the template.
+type Alerter struct {
+	Method          string
+	URL             string
+	Headers         map[string]string
+	Body            string // text/template rendering the batch
+	ContentType     string
+	Secret          string // signs the body with HMAC-SHA256 when set
+	SignatureHeader string // header holding the signature, sha256=<hex>
+	Username        string // basic authentication
+	Password        string
+	Token           string // bearer authentication
+	Success         []int  // status codes indicating success, defaults to any 2xx
+	Timeout         time.Duration
+	body            *template.Template
+	client          *http.Client
+}
+
+// UnmarshalTOML decodes the webhook configuration.
+func (t *Alerter) UnmarshalTOML(decode func(interface{}) error) error {
+	type tomlWebhook struct {
+		Method          string
+		URL             string
+		Headers         map[string]string
+		Body            string
+		ContentType     string
+		Secret          string
+		SignatureHeader string
+		Username        string
+		Password        string
+		Token           string
+		Success         []int
+		Timeout         string
+	}
+
+	var (
+		err error
+		dec tomlWebhook
+	)
+
+	if err = decode(&dec); err != nil {
+		return err
+	}
+
+	if dec.Timeout != "" {
+		if t.Timeout, err = time.ParseDuration(dec.Timeout); err != nil {
+			return notifications.KeyError{Key: "timeout", Err: errors.Errorf("invalid webhook timeout %q: %v", dec.Timeout, err)}
+		}
+	}
+
+	if dec.Body != "" {
+		if t.body, err = template.New("body").Funcs(message.Funcs()).Parse(dec.Body); err != nil {
+			return notifications.KeyError{Key: "body", Err: errors.Wrap(err, "invalid webhook body template")}
+		}
+	}
+
+	if dec.Method != "" {
+		t.Method = strings.ToUpper(dec.Method)
+	}
+
+	if dec.ContentType != "" {
+		t.ContentType = dec.ContentType
+	}
+
+	if dec.SignatureHeader != "" {
+		t.SignatureHeader = dec.SignatureHeader
+	}
+
+	t.URL = dec.URL
+	t.Headers = dec.Headers
+	t.Body = dec.Body
+	t.Secret = dec.Secret
+	t.Username = dec.Username
+	t.Password = dec.Password
+	t.Token = dec.Token
+	t.Success = dec.Success
+
+	return nil
+}
+
+// Validate the endpoint and authentication are configured.
+func (t *Alerter) Validate() error {
+	if u, err := url.Parse(t.URL); err != nil || u.Host == "" {
+		return errors.Errorf("invalid webhook url %q", t.URL)
+	}
+
+	if t.Token != "" && (t.Username != "" || t.Password != "") {
+		return errors.New("webhook can use either basic or bearer authentication, not both")
+	}
+
+	return nil
+}
+
+// Alert about the provided units.
+func (t *Alerter) Alert(units ...*systemd.UnitStatus) {
+	if err := t.Deliver(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// Resolve notifies the endpoint the provided units recovered.
+func (t *Alerter) Resolve(units ...*systemd.UnitStatus) {
+	if err := t.DeliverResolve(units...); err != nil {
+		log.Println(err)
+	}
+}
+
+// DeliverResolve reports the recovery of the provided units.
+func (t *Alerter) DeliverResolve(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(true, units...))
+}
+
+// Deliver the provided units to the endpoint.
+func (t *Alerter) Deliver(units ...*systemd.UnitStatus) error {
+	return t.send(message.New(false, units...))
+}
+
+func (t *Alerter) send(b message.Batch) (err error) {
+	var (
+		raw  []byte
+		req  *http.Request
+		resp *http.Response
+	)
+
+	if raw, err = t.render(b); err != nil {
+		return err
+	}
+
+	if req, err = http.NewRequest(t.Method, t.URL, bytes.NewReader(raw)); err != nil {
+		return errors.Wrap(err, "failed to create webhook request")
+	}
+
+	req.Header.Set("Content-Type", t.ContentType)
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	switch {
+	case t.Token != "":
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	case t.Username != "" || t.Password != "":
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+
+	if t.Secret != "" {
+		req.Header.Set(t.SignatureHeader, Sign(t.Secret, raw))
+	}
+
+	if t.client == nil {
+		t.client = &http.Client{Timeout: t.Timeout}
+	}
+
+	if resp, err = t.client.Do(req); err != nil {
+		return errors.Wrap(err, "failed to send webhook")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if !t.success(resp.StatusCode) {
+		return errors.Errorf("webhook request failed with status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (t *Alerter) render(b message.Batch) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+	)
+
+	if t.body == nil {
+		raw, err := json.Marshal(b)
+		return raw, errors.Wrap(err, "failed to encode webhook body")
+	}
+
+	if err := t.body.Execute(&buf, b); err != nil {
+		return nil, errors.Wrap(err, "failed to render webhook body")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (t *Alerter) success(code int) bool {
+	if len(t.Success) == 0 {
+		return code >= 200 && code < 300
+	}
+
+	for _, c := range t.Success {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign the body with HMAC-SHA256, formatted as sha256=<hex>.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package webhook_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/james-lawrence/systemd-alert/internal/notifytest"
+	"github.com/james-lawrence/systemd-alert/notifications/message"
+	"github.com/james-lawrence/systemd-alert/notifications/webhook"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+var unit = &systemd.UnitStatus{
+	Name:        "nginx.service",
+	ActiveState: "failed",
+	SubState:    "failed",
+	Host:        &systemd.Host{Hostname: "web1"},
+}
+
+func TestDeliverJSON(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusOK)
+	a := webhook.NewAlerter()
+	notifytest.Decode(t, a, `
+url = "`+srv.URL+`"
+token = "t0ken"
+secret = "s3cret"
+headers = { X-Team = "platform" }
+`)
+
+	if err := a.Deliver(unit); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-requests
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Team") != "platform" {
+		t.Fatalf("unexpected request %s %v", r.Method, r.Header)
+	}
+
+	if r.Header.Get("Authorization") != "Bearer t0ken" {
+		t.Errorf("expected bearer authentication, got %q", r.Header.Get("Authorization"))
+	}
+
+	if r.Header.Get("X-Signature-256") != webhook.Sign("s3cret", r.Body) {
+		t.Errorf("unexpected signature %q", r.Header.Get("X-Signature-256"))
+	}
+
+	var b message.Batch
+	r.Decode(t, &b)
+
+	if b.Status != message.StatusFiring || b.Host.Hostname != "web1" || len(b.Units) != 1 || b.Units[0].Severity != "critical" {
+		t.Fatalf("unexpected body %s", r.Body)
+	}
+}
+
+func TestDeliverTemplate(t *testing.T) {
+	srv, requests := notifytest.Serve(t, http.StatusAccepted)
+	a := webhook.NewAlerter()
+	notifytest.Decode(t, a, `
+method = "put"
+url = "`+srv.URL+`"
+content_type = "text/plain"
+username = "agent"
+password = "hunter2"
+success = [202]
+body = "{{ .Status }} on {{ .Host.Hostname }}:{{ range .Units }} {{ .Label }}={{ .SubState }}{{ end }}"
+`)
+
+	a.Resolve(unit)
+
+	r := <-requests
+	if user, pass, ok := (&http.Request{Header: r.Header}).BasicAuth(); !ok || user != "agent" || pass != "hunter2" {
+		t.Errorf("expected basic authentication, got %q", r.Header.Get("Authorization"))
+	}
+
+	if r.Method != http.MethodPut || string(r.Body) != "resolved on web1: nginx.service=failed" {
+		t.Fatalf("unexpected request %s %q", r.Method, r.Body)
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv, _ := notifytest.Serve(t, http.StatusOK)
+	a := webhook.NewAlerter()
+	notifytest.Decode(t, a, `
+url = "`+srv.URL+`"
+success = [204]
+`)
+
+	if err := a.Deliver(unit); err == nil {
+		t.Fatal("expected a status outside the success set to fail")
+	}
+
+	if err := a.DeliverResolve(unit); err == nil {
+		t.Fatal("expected a resolve outside the success set to fail")
+	}
+}
@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+// Recorded is a single event captured by Record.
+type Recorded struct {
+	Time time.Time           `json:"time"`
+	Type EventType           `json:"type"`
+	Unit *systemd.UnitStatus `json:"unit"`
+	Job  *systemd.Job        `json:"job,omitempty"`
+}
+
+// Record writes every event produced by the source to w as JSON lines until
+// the source is exhausted.
+func Record(src EventSource, w io.Writer) error {
+	events, err := src.Events()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for e := range events {
+		if e.Err != nil {
+			continue
+		}
+
+		if err = enc.Encode(Recorded{Time: time.Now(), Type: e.Type, Unit: e.Unit, Job: e.Job}); err != nil {
+			return errors.Wrap(err, "failed to record event")
+		}
+	}
+
+	return nil
+}
+
+// NewReplaySource replays events captured by Record. the delay between
+// events is divided by the speed, a speed of zero replays instantly.
+func NewReplaySource(r io.Reader, speed float64) EventSource {
+	return replay{r: r, speed: speed}
+}
+
+type replay struct {
+	r     io.Reader
+	speed float64
+}
+
+func (t replay) Events() (<-chan Event, error) {
+	dst := make(chan Event)
+
+	go func() {
+		var (
+			previous time.Time
+		)
+
+		defer close(dst)
+
+		scanner := bufio.NewScanner(t.r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var (
+				rec Recorded
+			)
+
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				dst <- Event{Err: errors.Wrapf(err, "failed to decode event line: %d", line)}
+				continue
+			}
+
+			if rec.Unit == nil {
+				dst <- Event{Err: errors.Errorf("event is missing a unit line: %d", line)}
+				continue
+			}
+
+			if t.speed > 0 && !previous.IsZero() && rec.Time.After(previous) {
+				time.Sleep(time.Duration(float64(rec.Time.Sub(previous)) / t.speed))
+			}
+			previous = rec.Time
+
+			dst <- Event{Type: rec.Type, Unit: rec.Unit, Job: rec.Job, Time: rec.Time}
+		}
+
+		if err := scanner.Err(); err != nil {
+			dst <- Event{Err: errors.Wrap(err, "failed to read events")}
+		}
+	}()
+
+	return dst, nil
+}
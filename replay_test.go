@@ -0,0 +1,94 @@
+package alerts_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/systemdtest"
+)
+
+const recording = `{"time":"2026-10-19T00:00:00Z","type":"loaded","unit":{"Name":"nginx.service","ActiveState":"active","SubState":"running"}}
+{"time":"2026-10-19T00:00:01Z","type":"changed","unit":{"Name":"nginx.service","ActiveState":"failed","SubState":"failed","Source":"web1"}}
+{"time":"2026-10-19T00:00:02Z","type":"job-removed","unit":{"Name":"nginx.service","Source":"web1"},"job":{"ID":1,"Path":"/org/freedesktop/systemd1/job/1","Unit":"nginx.service","Result":"failed"}}
+`
+
+func TestReplay(t *testing.T) {
+	rec := systemdtest.NewRecorder()
+	alerts.Run(alerts.NewReplaySource(strings.NewReader(recording), 0), alerts.AlertNotifiers(rec))
+
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 || units[0].Label() != "web1/nginx.service" || units[0].SubState != "failed" {
+		t.Fatalf("expected the recorded failure to be alerted, got %v", units)
+	}
+}
+
+// cooldown replays a unit with a minute cooldown failing repeatedly, and a
+// second unit failing alongside it.
+const cooldown = `{"time":"2026-10-19T00:00:00Z","type":"changed","unit":{"Name":"nginx.service","ActiveState":"failed","SubState":"failed","Settings":{"Cooldown":60000000000}}}
+{"time":"2026-10-19T00:00:00.5Z","type":"changed","unit":{"Name":"worker.service","ActiveState":"failed","SubState":"failed"}}
+{"time":"2026-10-19T00:00:10Z","type":"changed","unit":{"Name":"nginx.service","ActiveState":"active","SubState":"running","Settings":{"Cooldown":60000000000}}}
+{"time":"2026-10-19T00:00:20Z","type":"changed","unit":{"Name":"nginx.service","ActiveState":"failed","SubState":"failed","Settings":{"Cooldown":60000000000}}}
+{"time":"2026-10-19T00:02:00Z","type":"changed","unit":{"Name":"nginx.service","ActiveState":"activating","SubState":"auto-restart","Settings":{"Cooldown":60000000000}}}
+`
+
+func TestReplayFollowsRecordedTime(t *testing.T) {
+	rec := systemdtest.NewRecorder()
+	alerts.Run(alerts.NewReplaySource(strings.NewReader(cooldown), 0), alerts.AlertFrequency(time.Second), alerts.AlertNotifiers(rec))
+
+	// units recorded within the same window are batched together.
+	if units := systemdtest.Next(rec.Alerts, timeout); len(units) != 2 {
+		t.Fatalf("expected the failures recorded together to be batched, got %v", units)
+	}
+
+	if units := systemdtest.Next(rec.Resolved, timeout); len(units) != 1 || units[0].Name != "nginx.service" {
+		t.Fatalf("expected nginx.service to be resolved, got %v", units)
+	}
+
+	// the failure within the cooldown is suppressed, the restart after it is
+	// alerted even though the replay was instant.
+	units := systemdtest.Next(rec.Alerts, timeout)
+	if len(units) != 1 || units[0].SubState != "auto-restart" {
+		t.Fatalf("expected only the restart after the cooldown to be alerted, got %v", units)
+	}
+
+	if units := systemdtest.Next(rec.Alerts, 50*time.Millisecond); units != nil {
+		t.Fatalf("unexpected alert %v", units)
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	var (
+		buf bytes.Buffer
+	)
+
+	if err := alerts.Record(alerts.NewReplaySource(strings.NewReader(recording), 0), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := alerts.NewReplaySource(&buf, 0).Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := []alerts.EventType{}
+	for e := range events {
+		if e.Err != nil {
+			t.Fatal(e.Err)
+		}
+		types = append(types, e.Type)
+	}
+
+	expected := []alerts.EventType{alerts.EventLoaded, alerts.EventChanged, alerts.EventJobRemoved}
+	if len(types) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, types)
+		}
+	}
+}
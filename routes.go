@@ -0,0 +1,108 @@
+package alerts
+
+import (
+	"fmt"
+
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// Route restricts the notifier to units declaring one of the routes with
+// Route= in the [X-SystemdAlert] section of their unit files.
+func Route(n Notifier, routes ...string) Notifier {
+	return newRouted(n, true, routes)
+}
+
+// Unrouted restricts the notifier to units whose route is not claimed by
+// another notifier, including units without a route.
+func Unrouted(n Notifier, claimed ...string) Notifier {
+	return newRouted(n, false, claimed)
+}
+
+func newRouted(n Notifier, include bool, routes []string) *routed {
+	r := &routed{Notifier: n, include: include, routes: make(map[string]bool, len(routes))}
+	for _, route := range routes {
+		r.routes[route] = true
+	}
+
+	return r
+}
+
+// routed - forwards the units selected by their route to the notifier.
+type routed struct {
+	Notifier
+	include bool
+	routes  map[string]bool
+}
+
+func (t *routed) String() string {
+	return fmt.Sprintf("%T", t.Notifier)
+}
+
+// Alert about the routed units.
+func (t *routed) Alert(units ...*systemd.UnitStatus) {
+	if units = t.selected(units); len(units) > 0 {
+		t.Notifier.Alert(units...)
+	}
+}
+
+// Resolve the routed units if the notifier resolves alerts.
+func (t *routed) Resolve(units ...*systemd.UnitStatus) {
+	r, ok := t.Notifier.(Resolver)
+	if !ok {
+		return
+	}
+
+	if units = t.selected(units); len(units) > 0 {
+		r.Resolve(units...)
+	}
+}
+
+// Deliver the routed units, notifiers that cannot report delivery are
+// assumed to have succeeded.
+func (t *routed) Deliver(units ...*systemd.UnitStatus) error {
+	if units = t.selected(units); len(units) == 0 {
+		return nil
+	}
+
+	if d, ok := t.Notifier.(Deliverer); ok {
+		return d.Deliver(units...)
+	}
+
+	t.Notifier.Alert(units...)
+	return nil
+}
+
+// Start the notifier if it has work to do before the first batch.
+func (t *routed) Start() {
+	if s, ok := t.Notifier.(Starter); ok {
+		s.Start()
+	}
+}
+
+// Stop the notifier's background work.
+func (t *routed) Stop() {
+	if s, ok := t.Notifier.(Stopper); ok {
+		s.Stop()
+	}
+}
+
+func (t *routed) selected(units []*systemd.UnitStatus) []*systemd.UnitStatus {
+	selected := make([]*systemd.UnitStatus, 0, len(units))
+	for _, u := range units {
+		if t.routes[UnitRoute(u)] == t.include {
+			selected = append(selected, u)
+		}
+	}
+
+	return selected
+}
+
+// UnitRoute returns the route declared in the unit files, empty when the unit
+// does not declare one.
+func UnitRoute(status *systemd.UnitStatus) string {
+	if status.Settings == nil {
+		return ""
+	}
+
+	return status.Settings.Route
+}
@@ -0,0 +1,41 @@
+package alerts_test
+
+import (
+	"testing"
+
+	alerts "github.com/james-lawrence/systemd-alert"
+	"github.com/james-lawrence/systemd-alert/internal/systemdtest"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+func TestRoute(t *testing.T) {
+	var (
+		web       = &systemd.UnitStatus{Name: "nginx.service", SubState: "failed", Settings: &systemd.AlertSettings{Route: "web"}}
+		db        = &systemd.UnitStatus{Name: "postgres.service", SubState: "failed", Settings: &systemd.AlertSettings{Route: "db"}}
+		unrouted  = &systemd.UnitStatus{Name: "cron.service", SubState: "failed"}
+		routed    = systemdtest.NewRecorder()
+		remaining = systemdtest.NewRecorder()
+	)
+
+	notifiers := []alerts.Notifier{alerts.Route(routed, "web"), alerts.Unrouted(remaining, "web")}
+	for _, n := range notifiers {
+		n.Alert(web, db, unrouted)
+		n.(alerts.Resolver).Resolve(web)
+	}
+
+	if units := systemdtest.Next(routed.Alerts, timeout); len(units) != 1 || units[0] != web {
+		t.Errorf("expected only the web unit to be routed, got %v", units)
+	}
+
+	if units := systemdtest.Next(remaining.Alerts, timeout); len(units) != 2 || units[0] != db || units[1] != unrouted {
+		t.Errorf("expected the unclaimed units, got %v", units)
+	}
+
+	if units := systemdtest.Next(routed.Resolved, timeout); len(units) != 1 || units[0] != web {
+		t.Errorf("expected the web unit to be resolved, got %v", units)
+	}
+
+	if len(remaining.Resolved) != 0 {
+		t.Error("expected no resolution without routed units")
+	}
+}
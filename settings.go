@@ -0,0 +1,193 @@
+package alerts
+
+import (
+	"log"
+	"sync"
+
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+// NewSettings creates settings that can be shared by multiple run loops.
+func NewSettings(ignored []string, notifiers ...Notifier) *Settings {
+	s := &Settings{m: &sync.RWMutex{}}
+	s.store(ignored, notifiers)
+	return s
+}
+
+// Settings - the ignore list and notifiers used by running loops. they can be
+// replaced while the loops are running without losing their subscriptions or
+// the units they are alerting on.
+type Settings struct {
+	m         *sync.RWMutex
+	match     filter
+	notifiers []Notifier
+	queues    []*queue
+}
+
+// Reload replaces the ignore list and notifiers. the new notifiers are started
+// and notifiers that were removed are stopped once their pending batches were
+// delivered, retained notifiers keep running.
+func (t *Settings) Reload(ignored []string, notifiers ...Notifier) {
+	_, previous := t.current()
+	t.store(ignored, notifiers)
+
+	for _, n := range notifiers {
+		if retained(n, previous) {
+			continue
+		}
+
+		log.Printf("running %T\n", n)
+		if s, ok := n.(Starter); ok {
+			s.Start()
+		}
+	}
+}
+
+func (t *Settings) store(ignored []string, notifiers []Notifier) {
+	match := and(
+		IgnoreServices(ignored...),
+		IgnoreUnitSettings,
+		or(FilterAutorestart, FilterFailed),
+	)
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	queues := make([]*queue, 0, len(notifiers))
+	for _, n := range notifiers {
+		queues = append(queues, t.queue(n))
+	}
+
+	for _, q := range t.queues {
+		if !retained(q.notifier, notifiers) {
+			q.close(true)
+		}
+	}
+
+	t.match, t.notifiers, t.queues = match, notifiers, queues
+}
+
+// queue must be called while holding the lock, it reuses the queue of a
+// retained notifier so its pending batches stay in order.
+func (t *Settings) queue(n Notifier) *queue {
+	for _, q := range t.queues {
+		if q.notifier == n {
+			return q
+		}
+	}
+
+	return newQueue(n)
+}
+
+func (t *Settings) current() (filter, []Notifier) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	return t.match, t.notifiers
+}
+
+// deliver queues the batch for every notifier, done is released as each of
+// them finishes with it.
+func (t *Settings) deliver(resolve bool, units []*systemd.UnitStatus, done *sync.WaitGroup) {
+	t.m.RLock()
+	defer t.m.RUnlock()
+
+	for _, q := range t.queues {
+		if _, ok := q.notifier.(Resolver); resolve && !ok {
+			continue
+		}
+
+		q.push(delivery{resolve: resolve, units: units, done: done})
+	}
+}
+
+// Alert queues the units for every notifier, it returns without waiting for
+// them to be delivered.
+func (t *Settings) Alert(units ...*systemd.UnitStatus) {
+	t.deliver(false, units, &sync.WaitGroup{})
+}
+
+// Resolve queues the units for every notifier that resolves alerts, it
+// returns without waiting for them to be delivered.
+func (t *Settings) Resolve(units ...*systemd.UnitStatus) {
+	t.deliver(true, units, &sync.WaitGroup{})
+}
+
+// close the queues once their pending batches were delivered, the notifiers
+// are left running.
+func (t *Settings) close() {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, q := range t.queues {
+		q.close(false)
+	}
+	t.queues = nil
+}
+
+func retained(n Notifier, notifiers []Notifier) bool {
+	for _, c := range notifiers {
+		if c == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// batches a notifier may fall behind by before new batches are dropped.
+const queueSize = 64
+
+type delivery struct {
+	resolve bool
+	units   []*systemd.UnitStatus
+	done    *sync.WaitGroup
+}
+
+func newQueue(n Notifier) *queue {
+	q := &queue{notifier: n, pending: make(chan delivery, queueSize)}
+	go q.run()
+	return q
+}
+
+// queue delivers batches to a single notifier in the order they were flushed.
+// it runs in the background so a slow notifier holds up neither the event
+// loops nor the other notifiers.
+type queue struct {
+	notifier Notifier
+	pending  chan delivery
+	stop     bool
+}
+
+func (t *queue) run() {
+	for d := range t.pending {
+		if d.resolve {
+			t.notifier.(Resolver).Resolve(d.units...)
+		} else {
+			t.notifier.Alert(d.units...)
+		}
+		d.done.Done()
+	}
+
+	if s, ok := t.notifier.(Stopper); ok && t.stop {
+		s.Stop()
+	}
+}
+
+// push must be called while holding the settings lock. a full queue drops
+// the batch rather than blocking the event loop.
+func (t *queue) push(d delivery) {
+	d.done.Add(1)
+	select {
+	case t.pending <- d:
+	default:
+		d.done.Done()
+		log.Printf("%T is not keeping up, dropped a batch of %d units\n", t.notifier, len(d.units))
+	}
+}
+
+// close must be called while holding the settings lock.
+func (t *queue) close(stop bool) {
+	t.stop = stop
+	close(t.pending)
+}
@@ -0,0 +1,375 @@
+package alerts
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/james-lawrence/systemd-alert/systemd"
+	"github.com/pkg/errors"
+)
+
+// EventType describes what happened to a unit.
+type EventType int
+
+const (
+	// EventChanged the unit changed state.
+	EventChanged EventType = iota
+	// EventLoaded the unit is loaded by the manager. sent for every unit when a
+	// source subscribes and whenever a unit is loaded afterwards.
+	EventLoaded
+	// EventRemoved the unit was unloaded by the manager.
+	EventRemoved
+	// EventJobRemoved a job for the unit finished.
+	EventJobRemoved
+)
+
+var eventTypes = map[EventType]string{
+	EventChanged:    "changed",
+	EventLoaded:     "loaded",
+	EventRemoved:    "removed",
+	EventJobRemoved: "job-removed",
+}
+
+func (t EventType) String() string {
+	return eventTypes[t]
+}
+
+// MarshalText encodes the event type by name.
+func (t EventType) MarshalText() ([]byte, error) {
+	if s, ok := eventTypes[t]; ok {
+		return []byte(s), nil
+	}
+
+	return nil, errors.Errorf("unknown event type %d", int(t))
+}
+
+// UnmarshalText decodes the event type by name.
+func (t *EventType) UnmarshalText(raw []byte) error {
+	for k, s := range eventTypes {
+		if s == string(raw) {
+			*t = k
+			return nil
+		}
+	}
+
+	return errors.Errorf("unknown event type %q", string(raw))
+}
+
+// Event is a typed unit event produced by an EventSource. either Unit or Err
+// is set.
+type Event struct {
+	Type EventType
+	Unit *systemd.UnitStatus
+	Job  *systemd.Job // set for EventJobRemoved
+	Time time.Time    // when a replayed event was recorded, zero for live events
+	Err  error
+}
+
+// EventSource produces the unit events the alert pipeline acts on.
+type EventSource interface {
+	// Events subscribes to the source. The channel is closed once the source
+	// is exhausted or its connection is lost.
+	Events() (<-chan Event, error)
+}
+
+type sourceOption = func(*DBusSource)
+
+// SourceName label every unit from the source with the name, leave empty for
+// the local machine.
+func SourceName(name string) func(*DBusSource) {
+	return func(s *DBusSource) {
+		s.name = name
+	}
+}
+
+// SourceLabels user defined labels attached to the host identity of every unit.
+func SourceLabels(labels map[string]string) func(*DBusSource) {
+	return func(s *DBusSource) {
+		s.labels = labels
+	}
+}
+
+// SourceUnitFiles read the [X-SystemdAlert] section of the unit files, resolving
+// their paths relative to root. e.g. / for the local machine or
+// /proc/<pid>/root for a container.
+func SourceUnitFiles(root string) func(*DBusSource) {
+	return func(s *DBusSource) {
+		s.root = root
+	}
+}
+
+// NewDBusSource subscribes to the systemd manager on the connection.
+func NewDBusSource(conn *systemd.Conn, options ...sourceOption) *DBusSource {
+	s := &DBusSource{conn: conn, settings: make(map[dbus.ObjectPath]*systemd.AlertSettings)}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// DBusSource - produces events from the D-Bus signals of a systemd manager.
+type DBusSource struct {
+	conn     *systemd.Conn
+	name     string
+	labels   map[string]string
+	root     string
+	settings map[dbus.ObjectPath]*systemd.AlertSettings
+}
+
+// Events subscribes to the manager. the connection is closed if the
+// subscription fails.
+func (t *DBusSource) Events() (<-chan Event, error) {
+	var (
+		err   error
+		units []systemd.UnitStatus
+	)
+
+	src := make(chan *dbus.Signal)
+	dst := make(chan Event)
+	if err = t.conn.Subscribe(src); err != nil {
+		t.conn.Close()
+		return nil, err
+	}
+
+	if err = t.conn.Signals(systemd.UnitPropertiesChangedSignal, systemd.UnitNewSignal, systemd.UnitRemovedSignal, systemd.JobRemovedSignal, systemd.UnitFilesChangedSignal, systemd.ReloadingSignal); err != nil {
+		t.conn.Close()
+		return nil, err
+	}
+
+	host := t.identify()
+
+	if units, err = t.conn.ListUnits(); err != nil {
+		log.Println(err)
+	}
+
+	go func() {
+		// the connection was closed.
+		defer close(dst)
+
+		for i := range units {
+			unit := &units[i]
+			unit.Source = t.name
+			unit.Host = host
+			dst <- Event{Type: EventLoaded, Unit: unit}
+		}
+
+		for s := range src {
+			switch s.Name {
+			case "org.freedesktop.systemd1.Manager.UnitFilesChanged", "org.freedesktop.systemd1.Manager.Reloading":
+				// unit files may have been edited, reread them on the next change.
+				t.settings = make(map[dbus.ObjectPath]*systemd.AlertSettings)
+			case "org.freedesktop.systemd1.Manager.UnitNew", "org.freedesktop.systemd1.Manager.UnitRemoved":
+				var (
+					name string
+					path dbus.ObjectPath
+				)
+
+				if err := dbus.Store(s.Body, &name, &path); err != nil {
+					continue
+				}
+
+				e := Event{Type: EventLoaded, Unit: &systemd.UnitStatus{Name: name, Path: path, Source: t.name, Host: host}}
+				if s.Name == "org.freedesktop.systemd1.Manager.UnitRemoved" {
+					e.Type = EventRemoved
+				}
+				dst <- e
+			case "org.freedesktop.systemd1.Manager.JobRemoved":
+				var (
+					job systemd.Job
+				)
+
+				if err := dbus.Store(s.Body, &job.ID, &job.Path, &job.Unit, &job.Result); err != nil {
+					continue
+				}
+
+				dst <- Event{Type: EventJobRemoved, Unit: &systemd.UnitStatus{Name: job.Unit, Source: t.name, Host: host}, Job: &job}
+			case "org.freedesktop.DBus.Properties.PropertiesChanged":
+				if s.Body[0] != "org.freedesktop.systemd1.Unit" {
+					continue
+				}
+
+				unit, err := t.decode(s)
+				if err != nil {
+					dst <- Event{Err: err}
+					continue
+				}
+
+				unit.Host = host
+				unit.Settings = t.unitSettings(unit)
+				dst <- Event{Type: EventChanged, Unit: unit}
+			}
+		}
+	}()
+
+	return dst, nil
+}
+
+// Close the connection to the manager, ending the subscription.
+func (t *DBusSource) Close() {
+	t.conn.Close()
+}
+
+func (t *DBusSource) decode(s *dbus.Signal) (*systemd.UnitStatus, error) {
+	var (
+		err           error
+		status        systemd.UnitEvent
+		unitName      dbus.Variant
+		unitLoadState dbus.Variant
+	)
+
+	if status, err = systemd.DecodeUnitEvent(s); err != nil {
+		return nil, err
+	}
+
+	if unitName, err = t.conn.GetUnitProperty(status.Path, "Id"); err != nil {
+		return nil, errors.Wrap(err, "failed to get unit property: Id")
+	}
+
+	if unitLoadState, err = t.conn.GetUnitProperty(status.Path, "LoadState"); err != nil {
+		return nil, errors.Wrap(err, "failed to get unit property: LoadState")
+	}
+
+	unit := &systemd.UnitStatus{
+		Name:        unitName.Value().(string),
+		LoadState:   unitLoadState.Value().(string),
+		ActiveState: status.ActiveState,
+		SubState:    status.SubState,
+		Path:        status.Path,
+		Source:      t.name,
+	}
+
+	if strings.HasSuffix(unit.Name, ".service") {
+		if err = t.service(unit); err != nil {
+			return nil, err
+		}
+	}
+
+	return unit, nil
+}
+
+// service fills in the properties of the service interface.
+func (t *DBusSource) service(unit *systemd.UnitStatus) (err error) {
+	var (
+		result    dbus.Variant
+		nrestarts dbus.Variant
+	)
+
+	if result, err = t.conn.GetServiceProperty(unit.Path, "Result"); err != nil {
+		return errors.Wrap(err, "failed to get service property: Result")
+	}
+
+	if nrestarts, err = t.conn.GetServiceProperty(unit.Path, "NRestarts"); err != nil {
+		return errors.Wrap(err, "failed to get service property: NRestarts")
+	}
+
+	unit.Result, _ = result.Value().(string)
+	unit.NRestarts, _ = nrestarts.Value().(uint32)
+
+	return nil
+}
+
+// unitSettings returns the alert settings declared in the unit's files, they are
+// cached until the manager reports the unit files changed.
+func (t *DBusSource) unitSettings(unit *systemd.UnitStatus) *systemd.AlertSettings {
+	if t.root == "" {
+		return nil
+	}
+
+	if s, ok := t.settings[unit.Path]; ok {
+		return s
+	}
+
+	fragment, dropins, err := t.conn.UnitFiles(unit.Path)
+	if err != nil {
+		log.Println(errors.Wrapf(err, "failed to read unit files of %s", unit.Label()))
+		return nil
+	}
+
+	s, err := systemd.ReadAlertSettings(t.root, append([]string{fragment}, dropins...)...)
+	if err != nil {
+		log.Println(errors.Wrapf(err, "unit %s", unit.Label()))
+	}
+
+	t.settings[unit.Path] = &s
+	return &s
+}
+
+// identify the host the connection is monitoring. local connections fall back
+// to the agent's own identity.
+func (t *DBusSource) identify() *systemd.Host {
+	host, err := t.conn.Host()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if t.name == "" {
+		host = host.Merge(systemd.LocalHost())
+	}
+
+	host.Labels = t.labels
+
+	return &host
+}
+
+// Merge the events of multiple sources into a single source.
+func Merge(sources ...EventSource) EventSource {
+	return merged(sources)
+}
+
+type merged []EventSource
+
+// Events subscribes to every source, failing if any source fails. The channel
+// is closed once every source is exhausted.
+func (t merged) Events() (<-chan Event, error) {
+	var (
+		wg sync.WaitGroup
+	)
+
+	dst := make(chan Event)
+	channels := make([]<-chan Event, 0, len(t))
+	for i, s := range t {
+		events, err := s.Events()
+		if err != nil {
+			t[:i].cancel(channels)
+			return nil, err
+		}
+		channels = append(channels, events)
+	}
+
+	for _, events := range channels {
+		wg.Add(1)
+		go func(events <-chan Event) {
+			defer wg.Done()
+			for e := range events {
+				dst <- e
+			}
+		}(events)
+	}
+
+	go func() {
+		wg.Wait()
+		close(dst)
+	}()
+
+	return dst, nil
+}
+
+// cancel the subscriptions of the sources, closing the sources that can be
+// closed and discarding the events of the rest until they are exhausted.
+func (t merged) cancel(channels []<-chan Event) {
+	for i, s := range t {
+		if c, ok := s.(interface{ Close() }); ok {
+			c.Close()
+		}
+
+		go func(events <-chan Event) {
+			for range events {
+			}
+		}(channels[i])
+	}
+}
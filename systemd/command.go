@@ -0,0 +1,62 @@
+package systemd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+// commandTransport speaks D-Bus over the stdin and stdout of a child process.
+type commandTransport struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (t commandTransport) Close() error {
+	err := t.WriteCloser.Close()
+
+	if t.cmd.Process != nil {
+		t.cmd.Process.Kill()
+	}
+
+	// the process was killed, so the exit status is uninteresting.
+	t.cmd.Wait()
+
+	return err
+}
+
+func dialCommand(command ...string) (*dbus.Conn, error) {
+	var (
+		err    error
+		stdin  io.WriteCloser
+		stdout io.Reader
+	)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+
+	if stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, errors.Wrap(err, "failed to open command stdin")
+	}
+
+	if stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, errors.Wrap(err, "failed to open command stdout")
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "failed to start %s", command[0])
+	}
+
+	t := commandTransport{Reader: stdout, WriteCloser: stdin, cmd: cmd}
+	conn, err := dbus.NewConn(t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
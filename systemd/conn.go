@@ -58,3 +58,46 @@ func (c *Conn) GetUnitProperty(path dbus.ObjectPath, name string) (result dbus.V
 	err = c.sysconn.Object(c.sysobj.Destination(), path).Call("org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.systemd1.Unit", name).Store(&result)
 	return
 }
+
+// GetServiceProperty returns a property of a service unit.
+func (c *Conn) GetServiceProperty(path dbus.ObjectPath, name string) (result dbus.Variant, err error) {
+	err = c.sysconn.Object(c.sysobj.Destination(), path).Call("org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.systemd1.Service", name).Store(&result)
+	return
+}
+
+// ListUnits returns the status of every unit currently loaded by the manager.
+func (c *Conn) ListUnits() ([]UnitStatus, error) {
+	type unit struct {
+		Name        string
+		Description string
+		LoadState   string
+		ActiveState string
+		SubState    string
+		Followed    string
+		Path        dbus.ObjectPath
+		JobID       uint32
+		JobType     string
+		JobPath     dbus.ObjectPath
+	}
+
+	var (
+		loaded []unit
+	)
+
+	if err := c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnits", 0).Store(&loaded); err != nil {
+		return nil, errors.Wrap(err, "failed to list units")
+	}
+
+	units := make([]UnitStatus, 0, len(loaded))
+	for _, u := range loaded {
+		units = append(units, UnitStatus{
+			Name:        u.Name,
+			LoadState:   u.LoadState,
+			ActiveState: u.ActiveState,
+			SubState:    u.SubState,
+			Path:        u.Path,
+		})
+	}
+
+	return units, nil
+}
@@ -0,0 +1,107 @@
+package systemd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/james-lawrence/systemd-alert/internal/systemdtest"
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+func TestListUnits(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+	srv.AddUnit("nginx.service", "failed", "failed")
+
+	conn, err := srv.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	units, err := conn.ListUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(units) != 1 || units[0].Name != "nginx.service" || units[0].ActiveState != "failed" {
+		t.Fatalf("unexpected units %+v", units)
+	}
+}
+
+func TestHost(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+
+	conn, err := srv.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	h, err := conn.Host()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Hostname != systemdtest.Hostname || h.MachineID != systemdtest.MachineID {
+		t.Fatalf("unexpected host %+v", h)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := systemdtest.NewServer()
+	defer srv.Close()
+
+	conn, err := srv.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	signals := make(chan *dbus.Signal, 10)
+	if err = conn.Subscribe(signals); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conn.Signals(systemd.UnitNewSignal, systemd.UnitRemovedSignal, systemd.JobRemovedSignal, systemd.UnitPropertiesChangedSignal); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.AddUnit("nginx.service", "active", "running")
+	srv.SetState("nginx.service", "failed", "failed")
+	srv.JobRemoved(1, "nginx.service", "failed")
+	srv.RemoveUnit("nginx.service")
+
+	expected := []string{
+		"org.freedesktop.systemd1.Manager.UnitNew",
+		"org.freedesktop.DBus.Properties.PropertiesChanged",
+		"org.freedesktop.systemd1.Manager.JobRemoved",
+		"org.freedesktop.systemd1.Manager.UnitRemoved",
+	}
+
+	for _, name := range expected {
+		select {
+		case s := <-signals:
+			if s.Name != name {
+				t.Fatalf("expected %s, got %s", name, s.Name)
+			}
+
+			if s.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" {
+				continue
+			}
+
+			event, err := systemd.DecodeUnitEvent(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if event.ActiveState != "failed" || event.SubState != "failed" {
+				t.Fatalf("unexpected event %+v", event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package systemd
+
+import (
+	"log"
+	"runtime"
+	"syscall"
+
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+// dialAs connects to the bus at the given address with the credentials of
+// the provided user. the bus daemon checks the peer credentials captured at
+// connect time, so only the calling thread temporarily switches its
+// effective ids; the rest of the process keeps running as root. a thread
+// whose ids can't be restored would keep running the goroutine with the
+// user's credentials, so the process exits instead.
+func dialAs(uid, gid uint32, address string) (conn *dbus.Conn, err error) {
+	const keep = ^uintptr(0)
+
+	euid, egid := uintptr(syscall.Geteuid()), uintptr(syscall.Getegid())
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETRESGID, keep, uintptr(gid), keep); errno != 0 {
+		return nil, errors.Wrap(errno, "failed to switch effective gid")
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETRESUID, keep, uintptr(uid), keep); errno != 0 {
+		restore(syscall.SYS_SETRESGID, keep, egid)
+		return nil, errors.Wrap(errno, "failed to switch effective uid")
+	}
+
+	conn, err = dbus.Dial(address)
+
+	restore(syscall.SYS_SETRESUID, keep, euid)
+	restore(syscall.SYS_SETRESGID, keep, egid)
+
+	return conn, err
+}
+
+// restore the effective id of the thread, exiting if it can't be restored.
+func restore(call, keep, id uintptr) {
+	if _, _, errno := syscall.RawSyscall(call, keep, id, keep); errno != 0 {
+		log.Fatalln(errors.Wrap(errno, "failed to restore the effective credentials of the thread"))
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package systemd
+
+import (
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+func dialAs(uid, gid uint32, address string) (*dbus.Conn, error) {
+	return nil, errors.New("connecting as another user is only supported on linux")
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -85,6 +86,33 @@ func NewSystemdConnection() (*Conn, error) {
 	})
 }
 
+// NewAddressConnection establishes a connection to the bus at the given
+// address (e.g. unix:path=/run/dbus/system_bus_socket or tcp:host=...,port=...)
+// and authenticates. Callers should call Close() when done with the connection.
+func NewAddressConnection(address string) (*Conn, error) {
+	return NewConnection(func() (*dbus.Conn, error) {
+		return dbusAuthHelloConnection(func() (*dbus.Conn, error) {
+			return dbus.Dial(address)
+		})
+	})
+}
+
+// NewCommandConnection establishes a connection to a bus by spawning a command
+// that speaks D-Bus on its stdin and stdout, such as
+// `ssh host systemd-stdio-bridge`. Callers should call Close() when done with
+// the connection, which terminates the commands.
+func NewCommandConnection(command ...string) (*Conn, error) {
+	if len(command) == 0 {
+		return nil, errors.New("a command is required")
+	}
+
+	return NewConnection(func() (*dbus.Conn, error) {
+		return dbusAuthHelloConnection(func() (*dbus.Conn, error) {
+			return dialCommand(command...)
+		})
+	})
+}
+
 // NewConnection establishes a connection to a bus using a caller-supplied function.
 // This allows connecting to remote buses through a user-supplied mechanism.
 // The supplied function may be called multiple times, and should return independent connections.
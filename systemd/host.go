@@ -0,0 +1,111 @@
+package systemd
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+// Host identifies the machine a unit is running on.
+type Host struct {
+	Hostname  string
+	MachineID string
+	BootID    string
+	Labels    map[string]string // user defined labels
+}
+
+func (t *Host) String() string {
+	if t == nil {
+		return ""
+	}
+
+	if t.MachineID == "" {
+		return t.Hostname
+	}
+
+	return t.Hostname + " (" + t.MachineID + ")"
+}
+
+// Merge fills any missing identity from the provided host.
+func (t Host) Merge(o Host) Host {
+	if t.Hostname == "" {
+		t.Hostname = o.Hostname
+	}
+
+	if t.MachineID == "" {
+		t.MachineID = o.MachineID
+	}
+
+	if t.BootID == "" {
+		t.BootID = o.BootID
+	}
+
+	if t.Labels == nil {
+		t.Labels = o.Labels
+	}
+
+	return t
+}
+
+// LocalHost returns the identity of the machine the agent is running on.
+// identity that cannot be determined is left empty.
+func LocalHost() Host {
+	hostname, _ := os.Hostname()
+	return Host{
+		Hostname:  hostname,
+		MachineID: readID("/etc/machine-id"),
+		BootID:    strings.Replace(readID("/proc/sys/kernel/random/boot_id"), "-", "", -1),
+	}
+}
+
+func readID(path string) string {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(raw))
+}
+
+// Host returns the identity of the machine the connection's systemd is running
+// on, using systemd-hostnamed for the hostname and boot id. Returns the partial
+// identity along with the first error encountered.
+func (c *Conn) Host() (h Host, err error) {
+	var (
+		cause error
+		v     dbus.Variant
+	)
+
+	if err = c.sysobj.Call("org.freedesktop.DBus.Peer.GetMachineId", 0).Store(&h.MachineID); err != nil {
+		cause = errors.Wrap(err, "failed to get machine id")
+	}
+
+	hostnamed := c.sysconn.Object("org.freedesktop.hostname1", dbus.ObjectPath("/org/freedesktop/hostname1"))
+	if v, err = hostnamed.GetProperty("org.freedesktop.hostname1.Hostname"); err != nil {
+		if cause == nil {
+			cause = errors.Wrap(err, "failed to get hostname")
+		}
+	} else if s, ok := v.Value().(string); ok {
+		h.Hostname = s
+	}
+
+	// BootID is only available on newer versions of systemd-hostnamed.
+	if v, err = hostnamed.GetProperty("org.freedesktop.hostname1.BootID"); err == nil {
+		h.BootID = bootID(v.Value())
+	}
+
+	return h, cause
+}
+
+func bootID(v interface{}) string {
+	raw, ok := v.([]byte)
+	if !ok {
+		return ""
+	}
+
+	return hex.EncodeToString(raw)
+}
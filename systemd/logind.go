@@ -0,0 +1,190 @@
+package systemd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+// User is a user with a login session tracked by systemd-logind.
+type User struct {
+	UID  uint32
+	GID  uint32
+	Name string
+	Path dbus.ObjectPath
+}
+
+// UserEvent reports a user being added or removed.
+type UserEvent struct {
+	User
+	Removed bool
+}
+
+// Logind is a connection to systemd-logind.
+type Logind struct {
+	conn *dbus.Conn
+	obj  dbus.BusObject
+}
+
+// NewLogind connects to systemd-logind over the system bus.
+// Callers should call Close() when done with the connection.
+func NewLogind() (*Logind, error) {
+	conn, err := dbusAuthHelloConnection(dbus.SystemBusPrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logind{
+		conn: conn,
+		obj:  conn.Object("org.freedesktop.login1", dbus.ObjectPath("/org/freedesktop/login1")),
+	}, nil
+}
+
+// Close the connection.
+func (t *Logind) Close() {
+	t.conn.Close()
+}
+
+// ListUsers returns the users currently known to logind.
+func (t *Logind) ListUsers() ([]User, error) {
+	type listing struct {
+		UID  uint32
+		Name string
+		Path dbus.ObjectPath
+	}
+
+	var (
+		err      error
+		listings []listing
+	)
+
+	if err = t.obj.Call("org.freedesktop.login1.Manager.ListUsers", 0).Store(&listings); err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+
+	users := make([]User, 0, len(listings))
+	for _, l := range listings {
+		u := User{UID: l.UID, Name: l.Name, Path: l.Path}
+		if u.GID, err = t.gid(l.Path); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
+func (t *Logind) gid(path dbus.ObjectPath) (uint32, error) {
+	v, err := t.conn.Object("org.freedesktop.login1", path).GetProperty("org.freedesktop.login1.User.GID")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get user gid: %s", path)
+	}
+
+	gid, ok := v.Value().(uint32)
+	if !ok {
+		return 0, errors.Errorf("unexpected user gid type: %T", v.Value())
+	}
+
+	return gid, nil
+}
+
+func (t *Logind) name(path dbus.ObjectPath) (string, error) {
+	v, err := t.conn.Object("org.freedesktop.login1", path).GetProperty("org.freedesktop.login1.User.Name")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get user name: %s", path)
+	}
+
+	return fmt.Sprint(v.Value()), nil
+}
+
+// Watch reports every current user and then users as they are added and
+// removed. The channel is closed when the connection is.
+func (t *Logind) Watch() (<-chan UserEvent, error) {
+	var (
+		err   error
+		users []User
+	)
+
+	src := make(chan *dbus.Signal, signalBuffer)
+	dst := make(chan UserEvent)
+
+	for _, member := range []string{"UserNew", "UserRemoved"} {
+		match := fmt.Sprintf("type='signal',interface='org.freedesktop.login1.Manager',member='%s'", member)
+		if err = t.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match).Err; err != nil {
+			return nil, errors.Wrap(err, "failed to register signal")
+		}
+	}
+	t.conn.Signal(src)
+
+	// list after subscribing so no user is missed.
+	if users, err = t.ListUsers(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer close(dst)
+
+		for _, u := range users {
+			dst <- UserEvent{User: u}
+		}
+
+		for s := range src {
+			var (
+				err error
+				e   UserEvent
+			)
+
+			if err = dbus.Store(s.Body, &e.UID, &e.Path); err != nil {
+				continue
+			}
+
+			switch s.Name {
+			case "org.freedesktop.login1.Manager.UserRemoved":
+				e.Removed = true
+			case "org.freedesktop.login1.Manager.UserNew":
+				if e.GID, err = t.gid(e.Path); err != nil {
+					continue
+				}
+
+				if e.Name, err = t.name(e.Path); err != nil {
+					continue
+				}
+			default:
+				continue
+			}
+
+			dst <- e
+		}
+	}()
+
+	return dst, nil
+}
+
+// NewUserManagerConnection establishes a connection to the systemd --user
+// instance of the given user through their session bus at
+// /run/user/<uid>/bus, authenticating as that user. This requires root.
+// Callers should call Close() when done with the connection.
+func NewUserManagerConnection(u User) (*Conn, error) {
+	address := fmt.Sprintf("unix:path=/run/user/%d/bus", u.UID)
+
+	return NewConnection(func() (*dbus.Conn, error) {
+		conn, err := dialAs(u.UID, u.GID, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = conn.Auth([]dbus.Auth{dbus.AuthExternal(strconv.FormatUint(uint64(u.UID), 10))}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if err = conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	})
+}
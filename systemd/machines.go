@@ -0,0 +1,182 @@
+package systemd
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+// Machine is a virtual machine or container registered with systemd-machined.
+type Machine struct {
+	Name   string
+	Class  string // container or vm
+	Leader uint32 // pid of the machine's init process
+	Path   dbus.ObjectPath
+}
+
+// MachineEvent reports a machine being registered or removed.
+type MachineEvent struct {
+	Machine
+	Removed bool
+}
+
+// Machined is a connection to systemd-machined.
+type Machined struct {
+	conn *dbus.Conn
+	obj  dbus.BusObject
+}
+
+// NewMachined connects to systemd-machined over the system bus.
+// Callers should call Close() when done with the connection.
+func NewMachined() (*Machined, error) {
+	conn, err := dbusAuthHelloConnection(dbus.SystemBusPrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Machined{
+		conn: conn,
+		obj:  conn.Object("org.freedesktop.machine1", dbus.ObjectPath("/org/freedesktop/machine1")),
+	}, nil
+}
+
+// Close the connection.
+func (t *Machined) Close() {
+	t.conn.Close()
+}
+
+// ListMachines returns the currently registered machines.
+func (t *Machined) ListMachines() ([]Machine, error) {
+	type listing struct {
+		Name    string
+		Class   string
+		Service string
+		Path    dbus.ObjectPath
+	}
+
+	var (
+		err      error
+		listings []listing
+	)
+
+	if err = t.obj.Call("org.freedesktop.machine1.Manager.ListMachines", 0).Store(&listings); err != nil {
+		return nil, errors.Wrap(err, "failed to list machines")
+	}
+
+	machines := make([]Machine, 0, len(listings))
+	for _, l := range listings {
+		m := Machine{Name: l.Name, Class: l.Class, Path: l.Path}
+		if m.Leader, err = t.leader(l.Path); err != nil {
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+
+	return machines, nil
+}
+
+func (t *Machined) leader(path dbus.ObjectPath) (uint32, error) {
+	v, err := t.conn.Object("org.freedesktop.machine1", path).GetProperty("org.freedesktop.machine1.Machine.Leader")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get machine leader: %s", path)
+	}
+
+	leader, ok := v.Value().(uint32)
+	if !ok {
+		return 0, errors.Errorf("unexpected machine leader type: %T", v.Value())
+	}
+
+	return leader, nil
+}
+
+func (t *Machined) class(path dbus.ObjectPath) (string, error) {
+	v, err := t.conn.Object("org.freedesktop.machine1", path).GetProperty("org.freedesktop.machine1.Machine.Class")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get machine class: %s", path)
+	}
+
+	return fmt.Sprint(v.Value()), nil
+}
+
+// Watch reports every currently registered machine and then machines as they
+// are registered and removed. The channel is closed when the connection is.
+func (t *Machined) Watch() (<-chan MachineEvent, error) {
+	var (
+		err      error
+		machines []Machine
+	)
+
+	src := make(chan *dbus.Signal, signalBuffer)
+	dst := make(chan MachineEvent)
+
+	for _, member := range []string{"MachineNew", "MachineRemoved"} {
+		match := fmt.Sprintf("type='signal',interface='org.freedesktop.machine1.Manager',member='%s'", member)
+		if err = t.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match).Err; err != nil {
+			return nil, errors.Wrap(err, "failed to register signal")
+		}
+	}
+	t.conn.Signal(src)
+
+	// list after subscribing so no machine is missed.
+	if machines, err = t.ListMachines(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer close(dst)
+
+		for _, m := range machines {
+			dst <- MachineEvent{Machine: m}
+		}
+
+		for s := range src {
+			var (
+				err error
+				e   MachineEvent
+			)
+
+			if err = dbus.Store(s.Body, &e.Name, &e.Path); err != nil {
+				continue
+			}
+
+			switch s.Name {
+			case "org.freedesktop.machine1.Manager.MachineRemoved":
+				e.Removed = true
+			case "org.freedesktop.machine1.Manager.MachineNew":
+				if e.Leader, err = t.leader(e.Path); err != nil {
+					continue
+				}
+
+				if e.Class, err = t.class(e.Path); err != nil {
+					continue
+				}
+			default:
+				continue
+			}
+
+			dst <- e
+		}
+	}()
+
+	return dst, nil
+}
+
+// NewMachineConnection establishes a connection to the systemd instance running
+// inside of a container, using its private socket or, failing that, the
+// container's system bus. Callers should call Close() when done with the connection.
+func NewMachineConnection(m Machine) (*Conn, error) {
+	root := fmt.Sprintf("/proc/%d/root", m.Leader)
+
+	conn, err := NewConnection(func() (*dbus.Conn, error) {
+		// We skip Hello when talking directly to systemd.
+		return dbusAuthConnection(func() (*dbus.Conn, error) {
+			return dbus.Dial("unix:path=" + root + "/run/systemd/private")
+		})
+	})
+	if err == nil {
+		return conn, nil
+	}
+
+	return NewAddressConnection("unix:path=" + root + "/run/dbus/system_bus_socket")
+}
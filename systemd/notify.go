@@ -0,0 +1,67 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Notify sends a state update (e.g. READY=1) to the service manager using the
+// sd_notify protocol. It is a no-op when $NOTIFY_SOCKET is unset, i.e. when
+// the process was not started by systemd with Type=notify.
+func Notify(state string) error {
+	var (
+		err  error
+		conn *net.UnixConn
+	)
+
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+
+	if conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"}); err != nil {
+		return errors.Wrap(err, "failed to dial notify socket")
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return errors.Wrap(err, "failed to write notify socket")
+	}
+
+	return nil
+}
+
+// WatchdogInterval returns the watchdog timeout configured by the service
+// manager, zero when the watchdog is disabled for this process.
+func WatchdogInterval() (time.Duration, error) {
+	var (
+		err  error
+		usec uint64
+		pid  int
+	)
+
+	if s := os.Getenv("WATCHDOG_PID"); s != "" {
+		if pid, err = strconv.Atoi(s); err != nil {
+			return 0, errors.Wrapf(err, "invalid WATCHDOG_PID %q", s)
+		}
+
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	s := os.Getenv("WATCHDOG_USEC")
+	if s == "" {
+		return 0, nil
+	}
+
+	if usec, err = strconv.ParseUint(s, 10, 64); err != nil {
+		return 0, errors.Wrapf(err, "invalid WATCHDOG_USEC %q", s)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
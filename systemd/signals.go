@@ -25,3 +25,15 @@ func UnitPropertiesChangedSignal(conn *dbus.Conn) error {
 func JobRemovedSignal(conn *dbus.Conn) error {
 	return conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, "type='signal', interface='org.freedesktop.systemd1.Manager', member='JobRemoved'").Err
 }
+
+// UnitFilesChangedSignal registers to receive signals when unit files are
+// added, removed or edited on disk.
+func UnitFilesChangedSignal(conn *dbus.Conn) error {
+	return conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, "type='signal',interface='org.freedesktop.systemd1.Manager',member='UnitFilesChanged'").Err
+}
+
+// ReloadingSignal registers to receive signals when the manager reloads its
+// configuration, i.e. systemctl daemon-reload.
+func ReloadingSignal(conn *dbus.Conn) error {
+	return conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, "type='signal',interface='org.freedesktop.systemd1.Manager',member='Reloading'").Err
+}
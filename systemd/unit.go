@@ -11,7 +11,29 @@ type UnitStatus struct {
 	LoadState   string          // The load state (i.e. whether the unit file has been loaded successfully)
 	ActiveState string          // The active state (i.e. whether the unit is currently started or not)
 	SubState    string          // The sub state (a more fine-grained version of the active state that is specific to the unit type, which the active state is not)
+	Result      string          // The result of the service's last run, e.g. success, exit-code, signal, core-dump or timeout. empty for other unit types
+	NRestarts   uint32          // The number of automatic restarts of the service since it was last started
 	Path        dbus.ObjectPath // The unit object path
+	Source      string          // The name of the source the unit was observed on, empty for the local machine
+	Host        *Host           // The identity of the machine the unit is running on
+	Settings    *AlertSettings  // The alert settings declared in the unit files, nil when unknown
+}
+
+// Label returns the unit name qualified by the source it was observed on.
+func (t UnitStatus) Label() string {
+	if t.Source == "" {
+		return t.Name
+	}
+
+	return t.Source + "/" + t.Name
+}
+
+// Job - a job that finished for a unit.
+type Job struct {
+	ID     uint32          // The numeric job id
+	Path   dbus.ObjectPath // The job object path
+	Unit   string          // The primary unit name the job was for
+	Result string          // The result of the job: done, canceled, timeout, failed, dependency or skipped
 }
 
 type UnitEvent struct {
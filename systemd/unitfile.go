@@ -0,0 +1,235 @@
+package systemd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/pkg/errors"
+)
+
+// AlertSection is the name of the unit file section holding alert settings.
+const AlertSection = "X-SystemdAlert"
+
+// AlertSettings - per unit alert settings declared by the unit's owner in the
+// [X-SystemdAlert] section of the unit file or its drop-ins, e.g.
+//
+//	[X-SystemdAlert]
+//	Severity=critical
+//	Runbook=https://wiki.example.com/runbooks/nginx
+//	Owner=platform
+//	Cooldown=15min
+type AlertSettings struct {
+	Ignore   bool          // never alert about the unit
+	Route    string        // name of the route the unit's alerts belong to
+	Severity string        // e.g. critical, warning or info
+	Runbook  string        // link to the unit's runbook
+	Cooldown time.Duration // minimum time between alerts for the unit
+	Owner    string        // team or person responsible for the unit
+}
+
+// UnitFiles returns the fragment and drop-in paths the unit was loaded from.
+func (c *Conn) UnitFiles(path dbus.ObjectPath) (fragment string, dropins []string, err error) {
+	var (
+		v dbus.Variant
+	)
+
+	if v, err = c.GetUnitProperty(path, "FragmentPath"); err != nil {
+		return "", nil, errors.Wrap(err, "failed to get unit property: FragmentPath")
+	}
+	fragment, _ = v.Value().(string)
+
+	if v, err = c.GetUnitProperty(path, "DropInPaths"); err != nil {
+		return "", nil, errors.Wrap(err, "failed to get unit property: DropInPaths")
+	}
+	dropins, _ = v.Value().([]string)
+
+	return fragment, dropins, nil
+}
+
+// ReadAlertSettings reads the [X-SystemdAlert] section from the unit files in
+// order, later files override earlier ones. paths are resolved relative to
+// root, e.g. /proc/<pid>/root for units of a container. missing files are
+// ignored.
+func ReadAlertSettings(root string, paths ...string) (s AlertSettings, err error) {
+	for _, path := range paths {
+		var (
+			f *os.File
+		)
+
+		if path == "" {
+			continue
+		}
+
+		if f, err = os.Open(filepath.Join(root, path)); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return s, errors.Wrap(err, "failed to open unit file")
+		}
+
+		err = s.decode(f)
+		f.Close()
+
+		if err != nil {
+			return s, errors.Wrapf(err, "invalid %s section in %s", AlertSection, path)
+		}
+	}
+
+	return s, nil
+}
+
+// decode the alert section of a unit file, assignments override the current
+// settings and empty assignments reset them.
+func (t *AlertSettings) decode(r io.Reader) (err error) {
+	var (
+		section string
+		line    string
+	)
+
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		line += strings.TrimSpace(lines.Text())
+
+		// continuation lines.
+		if strings.HasSuffix(line, "\\") {
+			line = strings.TrimRight(strings.TrimSuffix(line, "\\"), " \t") + " "
+			continue
+		}
+
+		current := line
+		line = ""
+
+		switch {
+		case current == "", strings.HasPrefix(current, "#"), strings.HasPrefix(current, ";"):
+			continue
+		case strings.HasPrefix(current, "[") && strings.HasSuffix(current, "]"):
+			section = current[1 : len(current)-1]
+			continue
+		case section != AlertSection:
+			continue
+		}
+
+		parts := strings.SplitN(current, "=", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("invalid assignment %q", current)
+		}
+
+		if err = t.assign(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])); err != nil {
+			return err
+		}
+	}
+
+	return lines.Err()
+}
+
+func (t *AlertSettings) assign(key, value string) (err error) {
+	switch key {
+	case "Ignore":
+		if value == "" {
+			t.Ignore = false
+			return nil
+		}
+		t.Ignore, err = parseBoolean(value)
+	case "Route":
+		t.Route = value
+	case "Severity":
+		t.Severity = strings.ToLower(value)
+	case "Runbook":
+		t.Runbook = value
+	case "Owner":
+		t.Owner = value
+	case "Cooldown":
+		if value == "" {
+			t.Cooldown = 0
+			return nil
+		}
+		t.Cooldown, err = ParseTimespan(value)
+	default:
+		return errors.Errorf("unknown setting %s", key)
+	}
+
+	return errors.Wrap(err, key)
+}
+
+func parseBoolean(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "yes", "y", "true", "t", "on":
+		return true, nil
+	case "0", "no", "n", "false", "f", "off":
+		return false, nil
+	default:
+		return false, errors.Errorf("invalid boolean %q", value)
+	}
+}
+
+var timespanUnits = map[string]time.Duration{
+	"us":      time.Microsecond,
+	"usec":    time.Microsecond,
+	"ms":      time.Millisecond,
+	"msec":    time.Millisecond,
+	"":        time.Second,
+	"s":       time.Second,
+	"sec":     time.Second,
+	"second":  time.Second,
+	"seconds": time.Second,
+	"m":       time.Minute,
+	"min":     time.Minute,
+	"minute":  time.Minute,
+	"minutes": time.Minute,
+	"h":       time.Hour,
+	"hr":      time.Hour,
+	"hour":    time.Hour,
+	"hours":   time.Hour,
+	"d":       24 * time.Hour,
+	"day":     24 * time.Hour,
+	"days":    24 * time.Hour,
+	"w":       7 * 24 * time.Hour,
+	"week":    7 * 24 * time.Hour,
+	"weeks":   7 * 24 * time.Hour,
+}
+
+// ParseTimespan parses a time span the way systemd does, e.g. 90, 5min or
+// 1h 30s, see systemd.time(7). numbers without a unit are seconds.
+func ParseTimespan(value string) (d time.Duration, err error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return 0, errors.Errorf("invalid time span %q", value)
+	}
+
+	for s != "" {
+		var (
+			n    float64
+			unit time.Duration
+			ok   bool
+		)
+
+		i := strings.IndexFunc(s, func(r rune) bool { return !(r >= '0' && r <= '9' || r == '.') })
+		if i == -1 {
+			i = len(s)
+		}
+
+		if n, err = strconv.ParseFloat(s[:i], 64); err != nil {
+			return 0, errors.Errorf("invalid time span %q", value)
+		}
+		s = strings.TrimLeft(s[i:], " ")
+
+		j := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' || r == ' ' })
+		if j == -1 {
+			j = len(s)
+		}
+
+		if unit, ok = timespanUnits[s[:j]]; !ok {
+			return 0, errors.Errorf("invalid time span %q", value)
+		}
+		s = strings.TrimLeft(s[j:], " ")
+
+		d += time.Duration(n * float64(unit))
+	}
+
+	return d, nil
+}
@@ -0,0 +1,95 @@
+package systemd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/james-lawrence/systemd-alert/systemd"
+)
+
+func TestParseTimespan(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"90":       90 * time.Second,
+		"5min":     5 * time.Minute,
+		"1h 30s":   time.Hour + 30*time.Second,
+		"2d":       48 * time.Hour,
+		"1.5s":     1500 * time.Millisecond,
+		"1min30s":  90 * time.Second,
+		"250 msec": 250 * time.Millisecond,
+	} {
+		actual, err := systemd.ParseTimespan(value)
+		if err != nil {
+			t.Errorf("%s: %v", value, err)
+			continue
+		}
+
+		if actual != expected {
+			t.Errorf("%s: expected %s, got %s", value, expected, actual)
+		}
+	}
+
+	for _, value := range []string{"", "soon", "5 fortnights", "m5"} {
+		if _, err := systemd.ParseTimespan(value); err == nil {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestReadAlertSettings(t *testing.T) {
+	root, err := ioutil.TempDir("", "systemd-alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"nginx.service": `[Unit]
+Description=web server
+
+[Service]
+ExecStart=/usr/sbin/nginx
+
+[X-SystemdAlert]
+# owned by the platform team.
+Severity=Warning
+Owner=platform \
+  team
+Runbook=https://wiki.example.com/runbooks/nginx
+Cooldown=5min
+Route=web
+`,
+		"nginx.service.d/override.conf": `[X-SystemdAlert]
+Severity=critical
+Route=
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := systemd.ReadAlertSettings(root, "/nginx.service", "/nginx.service.d/override.conf", "/missing.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := systemd.AlertSettings{
+		Severity: "critical",
+		Owner:    "platform team",
+		Runbook:  "https://wiki.example.com/runbooks/nginx",
+		Cooldown: 5 * time.Minute,
+	}
+
+	if s != expected {
+		t.Fatalf("expected %+v, got %+v", expected, s)
+	}
+}